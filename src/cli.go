@@ -0,0 +1,287 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"framely/src/config"
+)
+
+const (
+	CRAWL_COMMAND = "crawl"
+	DIFF_COMMAND  = "diff"
+)
+
+// diffoptions holds the settings of the diff command
+type diffOptions struct {
+	baselineDir string
+	currentDir  string
+	outputDir   string
+	threshold   float64
+}
+
+// viewportflag binds a widthxheight flag value to the viewport fields of the config
+type viewportFlag struct {
+	cfg *config.Config
+}
+
+// string returns the current viewport in widthxheight format
+func (v viewportFlag) String() string {
+	if v.cfg == nil {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", v.cfg.ViewportWidth, v.cfg.ViewportHeight)
+}
+
+// set parses the flag value and stores the dimensions in the config
+func (v viewportFlag) Set(value string) error {
+	width, height, err := config.ParseViewport(value)
+	if err != nil {
+		return err
+	}
+	v.cfg.ViewportWidth = width
+	v.cfg.ViewportHeight = height
+	return nil
+}
+
+// listflag binds a comma-separated flag value to a string slice, appending trimmed, non-empty entries
+type listFlag struct {
+	values *[]string
+}
+
+// string returns the current values joined by commas
+func (l listFlag) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+// set splits the flag value on commas and appends each trimmed entry
+func (l listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		trimmed := strings.TrimSpace(item)
+		if trimmed != "" {
+			*l.values = append(*l.values, trimmed)
+		}
+	}
+	return nil
+}
+
+// ruleflag binds a repeatable flag to a list of url rules, each use adds one rule in [type:][match:]pattern format
+type ruleFlag struct {
+	rules *[]config.URLRule
+}
+
+// string returns the configured rules joined by spaces
+func (r ruleFlag) String() string {
+	if r.rules == nil {
+		return ""
+	}
+	formatted := make([]string, 0, len(*r.rules))
+	for _, rule := range *r.rules {
+		formatted = append(formatted, rule.String())
+	}
+	return strings.Join(formatted, " ")
+}
+
+// set parses the flag value as a url rule and appends it
+func (r ruleFlag) Set(value string) error {
+	rule, err := config.ParseURLRule(value)
+	if err != nil {
+		return err
+	}
+	*r.rules = append(*r.rules, rule)
+	return nil
+}
+
+// devicesflag binds a comma-separated list of device preset names to the config devices,
+// the first use of the flag replaces any devices loaded from a profile file
+type devicesFlag struct {
+	cfg      *config.Config
+	replaced *bool
+}
+
+// string returns the configured device names joined by commas
+func (d devicesFlag) String() string {
+	if d.cfg == nil {
+		return ""
+	}
+	names := make([]string, 0, len(d.cfg.Devices))
+	for _, device := range d.cfg.Devices {
+		names = append(names, device.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// set looks up each named preset and stores it in the config
+func (d devicesFlag) Set(value string) error {
+	if !*d.replaced {
+		d.cfg.Devices = make([]config.DeviceProfile, 0)
+		*d.replaced = true
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		trimmed := strings.TrimSpace(name)
+		if trimmed == "" {
+			continue
+		}
+		preset, err := config.LookupDevicePreset(trimmed)
+		if err != nil {
+			return err
+		}
+		d.cfg.Devices = append(d.cfg.Devices, preset)
+	}
+	return nil
+}
+
+// newcrawlflagset defines one flag per config field, bound directly to the given config,
+// so flags that are not passed keep whatever value the config already holds
+func newCrawlFlagSet(cfg *config.Config, configPath *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(CRAWL_COMMAND, flag.ContinueOnError)
+
+	fs.StringVar(configPath, "config", *configPath, "crawl profile file (.yaml, .yml, .json or .toml)")
+
+	fs.StringVar(&cfg.BaseURL, "url", cfg.BaseURL, "target website URL")
+	fs.IntVar(&cfg.MaxDepth, "depth", cfg.MaxDepth, fmt.Sprintf("maximum crawl depth (1-%d)", config.MAX_CRAWL_DEPTH))
+	fs.IntVar(&cfg.MaxPages, "max-pages", cfg.MaxPages, "stop after capturing this many pages, 0 means no limit")
+	fs.IntVar(&cfg.MaxPrefixPages, "max-pages-per-prefix", cfg.MaxPrefixPages, "capture at most this many pages under each first path segment, e.g. /products, 0 means no limit")
+	fs.IntVar(&cfg.ParallelWorkers, "workers", cfg.ParallelWorkers, fmt.Sprintf("number of parallel workers (1-%d), 1 runs sequentially", config.MAX_PARALLEL_WORKERS))
+	fs.IntVar(&cfg.ScreenshotDelay, "screenshot-delay", cfg.ScreenshotDelay, "seconds to wait before capturing with the delay wait strategy, and the fallback when another strategy times out")
+	fs.IntVar(&cfg.RequestDelay, "request-delay", cfg.RequestDelay, "seconds to wait between requests in sequential mode")
+	fs.Var(viewportFlag{cfg: cfg}, "viewport", "viewport size in WIDTHxHEIGHT format")
+	fs.Var(devicesFlag{cfg: cfg, replaced: new(bool)}, "devices", fmt.Sprintf("comma-separated device presets to capture each page with (%s)", strings.Join(config.DevicePresetNames(), ", ")))
+	fs.StringVar(&cfg.CaptureMode, "capture", cfg.CaptureMode, "capture mode (full, viewport, element, clip)")
+	fs.StringVar(&cfg.CaptureSelector, "selector", cfg.CaptureSelector, "CSS selector to capture in element mode, e.g. main or #hero")
+	fs.StringVar(&cfg.CaptureClip, "clip", cfg.CaptureClip, "page area to capture in clip mode as x,y,width,height")
+	fs.StringVar(&cfg.WaitStrategy, "wait", cfg.WaitStrategy, "how to decide a page is ready (delay, network-idle, selector, expression, load, domcontentloaded, resources)")
+	fs.StringVar(&cfg.WaitSelector, "wait-selector", cfg.WaitSelector, "CSS selector that must be visible in selector wait mode")
+	fs.StringVar(&cfg.WaitExpression, "wait-expression", cfg.WaitExpression, "JavaScript expression that must become truthy in expression wait mode")
+	fs.IntVar(&cfg.NetworkIdleTime, "network-idle", cfg.NetworkIdleTime, "milliseconds without network requests that count as idle in network-idle wait mode")
+	fs.StringVar(&cfg.WaitTimeout, "wait-timeout", cfg.WaitTimeout, "maximum time for the wait strategy before falling back to the screenshot delay")
+	fs.StringVar(&cfg.ImageFormat, "format", cfg.ImageFormat, "screenshot image format (png, jpeg, webp)")
+	fs.IntVar(&cfg.Quality, "quality", cfg.Quality, "screenshot quality for jpeg and webp (1-100)")
+	fs.BoolVar(&cfg.CheckSitemap, "sitemap", cfg.CheckSitemap, "check sitemap.xml for additional URLs")
+	fs.BoolVar(&cfg.CheckRobots, "robots", cfg.CheckRobots, "check robots.txt for sitemap references")
+	fs.BoolVar(&cfg.IgnoreRobots, "ignore-robots", cfg.IgnoreRobots, "ignore robots.txt allow, disallow and crawl-delay rules, for sites you own")
+	fs.Var(listFlag{values: &cfg.SkipPatterns}, "skip", "additional comma-separated URL patterns to skip")
+	fs.Var(ruleFlag{rules: &cfg.IncludeRules}, "include", "only crawl URLs matching this rule, in [glob|regex:][path|query|url:]pattern format, e.g. /docs/**, repeatable")
+	fs.Var(ruleFlag{rules: &cfg.ExcludeRules}, "exclude", "skip URLs matching this rule, in [glob|regex:][path|query|url:]pattern format, e.g. regex:/print$, repeatable")
+	fs.Var(listFlag{values: &cfg.QueryAllow}, "query-allow", "comma-separated query parameters that identify a page, all others are ignored, * matches any characters")
+	fs.Var(listFlag{values: &cfg.QueryDeny}, "query-deny", "additional comma-separated query parameters to ignore when comparing URLs, e.g. sessionid,ref_*")
+	fs.BoolVar(&cfg.StripQuery, "strip-query", cfg.StripQuery, "ignore the whole query string when comparing URLs")
+	fs.BoolVar(&cfg.SortQuery, "sort-query", cfg.SortQuery, "sort query parameters so their order does not matter when comparing URLs")
+	fs.BoolVar(&cfg.LowercaseHost, "lowercase-host", cfg.LowercaseHost, "compare URL hosts case-insensitively")
+	fs.BoolVar(&cfg.StripDefaultPort, "strip-default-port", cfg.StripDefaultPort, "treat :80 on http and :443 on https as if no port was given")
+	fs.Var(listFlag{values: &cfg.IndexFiles}, "index-files", "additional comma-separated file names treated as their directory, e.g. default.aspx")
+	fs.StringVar(&cfg.UserAgent, "user-agent", cfg.UserAgent, "browser user agent")
+	fs.StringVar(&cfg.OutputDir, "out", cfg.OutputDir, "output directory for screenshots and reports")
+	fs.BoolVar(&cfg.EnableJavaScript, "javascript", cfg.EnableJavaScript, "run page JavaScript while rendering")
+	fs.BoolVar(&cfg.EnableImages, "images", cfg.EnableImages, "load images while rendering")
+	fs.BoolVar(&cfg.EnableExtensions, "extensions", cfg.EnableExtensions, "allow browser extensions")
+	fs.Var(listFlag{values: &cfg.ChromeFlags}, "chrome-flag", "extra comma-separated Chrome flags, e.g. --lang=de,--force-dark-mode")
+	fs.StringVar(&cfg.ChromePath, "chrome-path", cfg.ChromePath, "path to a custom Chrome or Chromium binary")
+	fs.BoolVar(&cfg.FailOnHTTPError, "fail-on-http-error", cfg.FailOnHTTPError, "count pages answering with a non-2xx status as failed instead of capturing them")
+	fs.StringVar(&cfg.PageLoadTimeout, "page-timeout", cfg.PageLoadTimeout, "maximum time to load a page before it counts as timed out")
+	fs.StringVar(&cfg.CaptureTimeout, "capture-timeout", cfg.CaptureTimeout, "maximum time per device to wait, collect links and take the screenshot")
+	fs.StringVar(&cfg.CrawlTimeout, "crawl-timeout", cfg.CrawlTimeout, "maximum time for the whole crawl, e.g. 2h, unset or 0 means no limit")
+	fs.StringVar(&cfg.ShutdownGrace, "shutdown-grace", cfg.ShutdownGrace, "time pages in progress get to finish after ctrl-c or sigterm before they are interrupted")
+	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "continue an interrupted crawl from the checkpoint in the output directory")
+	fs.StringVar(&cfg.CheckpointEvery, "checkpoint-interval", cfg.CheckpointEvery, "how often to checkpoint the crawl state to the output directory, 0 only checkpoints when the crawl ends")
+	fs.IntVar(&cfg.RetryAttempts, "retries", cfg.RetryAttempts, fmt.Sprintf("maximum capture attempts per page for transient errors (1-%d), 1 disables retries", config.MAX_RETRY_ATTEMPTS))
+	fs.StringVar(&cfg.RetryBackoff, "retry-backoff", cfg.RetryBackoff, "delay before the first retry, doubled on every further retry")
+	fs.StringVar(&cfg.RetryMaxBackoff, "retry-max-backoff", cfg.RetryMaxBackoff, "upper bound of the retry delay")
+	fs.StringVar(&cfg.RecapturePolicy, "recapture", cfg.RecapturePolicy, "recapture pages already in report.json (never, always, older-than, if-changed)")
+	fs.StringVar(&cfg.RecaptureAfter, "recapture-after", cfg.RecaptureAfter, "age after which older-than recaptures a page, e.g. 72h")
+	fs.StringVar(&cfg.DiffBaseline, "diff-baseline", cfg.DiffBaseline, "compare this run against the report in the given baseline directory")
+	fs.Float64Var(&cfg.DiffThreshold, "diff-threshold", cfg.DiffThreshold, "flag pages whose pixel difference exceeds this percentage")
+	fs.IntVar(&cfg.TabRecycleAfter, "tab-recycle", cfg.TabRecycleAfter, "replace each browser tab after this many pages, 0 never recycles")
+
+	return fs
+}
+
+// parsecrawlflags builds a config from the crawl command line arguments and validates it,
+// values are layered as defaults, then the --config profile file, then framely_ environment
+// variables, then explicitly passed flags
+func parseCrawlFlags(args []string) (*config.Config, error) {
+	configPath := ""
+
+	probe := newCrawlFlagSet(config.NewConfig(""), &configPath)
+	if err := probe.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if probe.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(probe.Args(), " "))
+	}
+
+	cfg := config.NewConfig("")
+	if configPath != "" {
+		loaded, err := config.LoadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	if err := config.ApplyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	fs := newCrawlFlagSet(cfg, &configPath)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return cfg, nil
+}
+
+// parsediffflags reads the diff command line arguments, the output directory defaults to the current run
+func parseDiffFlags(args []string) (*diffOptions, error) {
+	opts := &diffOptions{threshold: config.DEFAULT_DIFF_THRESHOLD}
+
+	fs := flag.NewFlagSet(DIFF_COMMAND, flag.ContinueOnError)
+	fs.StringVar(&opts.baselineDir, "baseline", "", "directory of the baseline run")
+	fs.StringVar(&opts.currentDir, "current", "", "directory of the run to compare")
+	fs.StringVar(&opts.outputDir, "out", "", "directory for the diff images and report (default: the current directory)")
+	fs.Float64Var(&opts.threshold, "threshold", opts.threshold, "flag pages whose pixel difference exceeds this percentage")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if opts.baselineDir == "" || opts.currentDir == "" {
+		return nil, fmt.Errorf("both --baseline and --current are required")
+	}
+
+	if err := config.ValidateDiffThreshold(opts.threshold); err != nil {
+		return nil, err
+	}
+
+	if opts.outputDir == "" {
+		opts.outputDir = opts.currentDir
+	}
+
+	return opts, nil
+}
+
+// isterminal reports whether the given file is attached to a character device such as a tty
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"framely/src/config"
+)
+
+// writeprofile writes a yaml crawl profile to a temporary directory and returns its path
+func writeProfile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "framely.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testparsecrawlflagsprecedence checks that values are layered as defaults, then the profile file,
+// then framely_ environment variables, then flags, wherever --config appears on the command line
+func TestParseCrawlFlagsPrecedence(t *testing.T) {
+	profile := writeProfile(t, `url: example.com
+maxDepth: 3
+parallelWorkers: 2
+checkSitemap: true
+skipPatterns: ["/admin"]
+devices:
+  - name: iphone
+`)
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		check func(t *testing.T, cfg *config.Config)
+	}{
+		{
+			name: "defaults",
+			args: []string{"--url", "example.com"},
+			check: func(t *testing.T, cfg *config.Config) {
+				defaults := config.NewConfig("https://example.com")
+				if !reflect.DeepEqual(cfg, defaults) {
+					t.Errorf("config = %+v, want the defaults %+v", cfg, defaults)
+				}
+			},
+		},
+		{
+			name: "file over defaults",
+			args: []string{"--config", profile},
+			check: func(t *testing.T, cfg *config.Config) {
+				if cfg.MaxDepth != 3 || cfg.ParallelWorkers != 2 || cfg.Quality != config.DEFAULT_SCREENSHOT_QUALITY {
+					t.Errorf("depth %d, workers %d, quality %d, want 3, 2 and the default quality", cfg.MaxDepth, cfg.ParallelWorkers, cfg.Quality)
+				}
+			},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"FRAMELY_MAX_DEPTH": "4"},
+			args: []string{"--config", profile},
+			check: func(t *testing.T, cfg *config.Config) {
+				if cfg.MaxDepth != 4 || cfg.ParallelWorkers != 2 {
+					t.Errorf("depth %d, workers %d, want 4 from the environment and 2 from the file", cfg.MaxDepth, cfg.ParallelWorkers)
+				}
+			},
+		},
+		{
+			name: "flag over env",
+			env:  map[string]string{"FRAMELY_MAX_DEPTH": "4"},
+			args: []string{"--depth", "6", "--config", profile, "--sitemap=false"},
+			check: func(t *testing.T, cfg *config.Config) {
+				if cfg.MaxDepth != 6 || cfg.CheckSitemap {
+					t.Errorf("depth %d, sitemap %v, want the flag values 6 and false", cfg.MaxDepth, cfg.CheckSitemap)
+				}
+			},
+		},
+		{
+			name: "flag fixes an env value out of range",
+			env:  map[string]string{"FRAMELY_QUALITY": "0"},
+			args: []string{"--url", "example.com", "--quality", "80"},
+			check: func(t *testing.T, cfg *config.Config) {
+				if cfg.Quality != 80 {
+					t.Errorf("quality = %d, want 80 from the flag", cfg.Quality)
+				}
+			},
+		},
+		{
+			name: "viewport flag",
+			args: []string{"--url", "example.com", "--viewport", "1366x768"},
+			check: func(t *testing.T, cfg *config.Config) {
+				if cfg.ViewportWidth != 1366 || cfg.ViewportHeight != 768 {
+					t.Errorf("viewport = %dx%d, want 1366x768", cfg.ViewportWidth, cfg.ViewportHeight)
+				}
+			},
+		},
+		{
+			name: "devices flag replaces file devices",
+			args: []string{"--config", profile, "--devices", "tablet, android", "--devices", "laptop"},
+			check: func(t *testing.T, cfg *config.Config) {
+				want := []config.DeviceProfile{config.DEVICE_PRESETS["tablet"], config.DEVICE_PRESETS["android"], config.DEVICE_PRESETS["laptop"]}
+				if !reflect.DeepEqual(cfg.Devices, want) {
+					t.Errorf("devices = %+v, want tablet, android and laptop", cfg.Devices)
+				}
+			},
+		},
+		{
+			name: "list flags add to file and env values",
+			env:  map[string]string{"FRAMELY_QUERY_DENY": "sessionid"},
+			args: []string{"--config", profile, "--skip", "/cart, /checkout,", "--query-deny", "ref_*"},
+			check: func(t *testing.T, cfg *config.Config) {
+				if !reflect.DeepEqual(cfg.SkipPatterns, []string{"/admin", "/cart", "/checkout"}) {
+					t.Errorf("skip patterns = %v", cfg.SkipPatterns)
+				}
+				if !reflect.DeepEqual(cfg.QueryDeny, []string{"sessionid", "ref_*"}) {
+					t.Errorf("query deny = %v", cfg.QueryDeny)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := parseCrawlFlags(test.args)
+			if err != nil {
+				t.Fatalf("parseCrawlFlags error: %v", err)
+			}
+			test.check(t, cfg)
+		})
+	}
+}
+
+// testparsecrawlflagsrejectsinvalidvalues checks that bad flag, environment and profile values
+// are reported instead of silently falling back to a default
+func TestParseCrawlFlagsRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{"missing url", nil, []string{}},
+		{"depth out of range", nil, []string{"--url", "example.com", "--depth", "0"}},
+		{"depth not a number", nil, []string{"--url", "example.com", "--depth", "deep"}},
+		{"viewport format", nil, []string{"--url", "example.com", "--viewport", "1366"}},
+		{"unknown device", nil, []string{"--url", "example.com", "--devices", "watch"}},
+		{"unknown format", nil, []string{"--url", "example.com", "--format", "gif"}},
+		{"unknown flag", nil, []string{"--url", "example.com", "--deph", "3"}},
+		{"extra argument", nil, []string{"--url", "example.com", "example.org"}},
+		{"missing profile", nil, []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")}},
+		{"invalid env value", map[string]string{"FRAMELY_PARALLEL_WORKERS": "many"}, []string{"--url", "example.com"}},
+		{"env value out of range", map[string]string{"FRAMELY_QUALITY": "0"}, []string{"--url", "example.com", "--workers", "3"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			if cfg, err := parseCrawlFlags(test.args); err == nil {
+				t.Fatalf("parseCrawlFlags(%v) = %+v, want an error", test.args, cfg)
+			}
+		})
+	}
+}
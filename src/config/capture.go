@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	CAPTURE_MODE_FULL     = "full"
+	CAPTURE_MODE_VIEWPORT = "viewport"
+	CAPTURE_MODE_ELEMENT  = "element"
+	CAPTURE_MODE_CLIP     = "clip"
+	DEFAULT_CAPTURE_MODE  = CAPTURE_MODE_FULL
+)
+
+// capturerule selects what part of a page is captured, rules with a pattern apply to urls containing
+// that pattern case-insensitively, the same way skip patterns match
+type CaptureRule struct {
+	Pattern  string `json:"pattern" yaml:"pattern" toml:"pattern"`
+	Mode     string `json:"mode" yaml:"mode" toml:"mode"`
+	Selector string `json:"selector" yaml:"selector" toml:"selector"`
+	Clip     string `json:"clip" yaml:"clip" toml:"clip"`
+}
+
+// cliprect is a page area in css pixels, measured from the top left of the document
+type ClipRect struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+// string formats the clip rectangle as x,y,width,height
+func (cr ClipRect) String() string {
+	return fmt.Sprintf("%g,%g,%g,%g", cr.X, cr.Y, cr.Width, cr.Height)
+}
+
+// parseclip parses a clip rectangle in x,y,width,height format, e.g. 0,0,1280,600
+func ParseClip(value string) (ClipRect, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return ClipRect{}, fmt.Errorf("clip must be in x,y,width,height format")
+	}
+
+	numbers := make([]float64, 4)
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return ClipRect{}, fmt.Errorf("invalid clip value %q", strings.TrimSpace(part))
+		}
+		numbers[i] = number
+	}
+
+	clip := ClipRect{X: numbers[0], Y: numbers[1], Width: numbers[2], Height: numbers[3]}
+	if clip.X < 0 || clip.Y < 0 {
+		return ClipRect{}, fmt.Errorf("clip position cannot be negative")
+	}
+	if clip.Width <= 0 || clip.Height <= 0 {
+		return ClipRect{}, fmt.Errorf("clip size must be positive")
+	}
+
+	return clip, nil
+}
+
+// target returns the selector or clip the rule captures, or an empty string for full and viewport modes
+func (cr CaptureRule) Target() string {
+	switch cr.Mode {
+	case CAPTURE_MODE_ELEMENT:
+		return cr.Selector
+	case CAPTURE_MODE_CLIP:
+		return cr.Clip
+	default:
+		return ""
+	}
+}
+
+// capturefor returns the capture rule for the url, the first matching per-url rule wins,
+// otherwise the global capture settings are used
+func (c *Config) CaptureFor(url string) CaptureRule {
+	lowerURL := strings.ToLower(url)
+	for _, rule := range c.CaptureRules {
+		if strings.Contains(lowerURL, strings.ToLower(rule.Pattern)) {
+			return rule
+		}
+	}
+
+	return CaptureRule{
+		Mode:     c.CaptureMode,
+		Selector: c.CaptureSelector,
+		Clip:     c.CaptureClip,
+	}
+}
+
+// validatecapturerule checks that a rule has a known mode and the selector or clip that mode needs
+func validateCaptureRule(rule CaptureRule, modeField, selectorField, clipField string) []error {
+	var errs []error
+
+	switch rule.Mode {
+	case CAPTURE_MODE_FULL, CAPTURE_MODE_VIEWPORT:
+	case CAPTURE_MODE_ELEMENT:
+		if strings.TrimSpace(rule.Selector) == "" {
+			errs = append(errs, fieldErrorf(selectorField, "element capture needs a CSS selector"))
+		}
+	case CAPTURE_MODE_CLIP:
+		if _, err := ParseClip(rule.Clip); err != nil {
+			errs = append(errs, &FieldError{Field: clipField, Err: err})
+		}
+	default:
+		errs = append(errs, fieldErrorf(modeField, "capture mode must be one of full, viewport, element, clip"))
+	}
+
+	return errs
+}
+
+// validatecapture checks the global capture settings and every per-url capture rule
+func (c *Config) validateCapture() []error {
+	errs := validateCaptureRule(CaptureRule{
+		Mode:     c.CaptureMode,
+		Selector: c.CaptureSelector,
+		Clip:     c.CaptureClip,
+	}, "captureMode", "captureSelector", "captureClip")
+
+	return append(errs, validateList("captureRules", c.CaptureRules, func(rule CaptureRule) []error {
+		var errs []error
+		if strings.TrimSpace(rule.Pattern) == "" {
+			errs = append(errs, fieldErrorf("pattern", "capture rule pattern cannot be empty"))
+		}
+		return append(errs, validateCaptureRule(rule, "mode", "selector", "clip")...)
+	})...)
+}
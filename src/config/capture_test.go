@@ -0,0 +1,69 @@
+package config
+
+import "testing"
+
+// testparseclip checks the x,y,width,height format and its range checks
+func TestParseClip(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ClipRect
+		wantErr bool
+	}{
+		{"0,0,1280,600", ClipRect{Width: 1280, Height: 600}, false},
+		{" 10, 20.5 ,300,400 ", ClipRect{X: 10, Y: 20.5, Width: 300, Height: 400}, false},
+		{"0,0,1280", ClipRect{}, true},
+		{"0,0,wide,600", ClipRect{}, true},
+		{"-1,0,100,100", ClipRect{}, true},
+		{"0,0,0,100", ClipRect{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseClip(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseClip(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseClip(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+// testvalidatecapturerule checks every capture mode together with the selector or clip it needs
+func TestValidateCaptureRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule CaptureRule
+		want []string
+	}{
+		{"full", CaptureRule{Mode: CAPTURE_MODE_FULL}, []string{}},
+		{"viewport", CaptureRule{Mode: CAPTURE_MODE_VIEWPORT}, []string{}},
+		{"element", CaptureRule{Mode: CAPTURE_MODE_ELEMENT, Selector: "main"}, []string{}},
+		{"element missing selector", CaptureRule{Mode: CAPTURE_MODE_ELEMENT}, []string{"selector"}},
+		{"clip", CaptureRule{Mode: CAPTURE_MODE_CLIP, Clip: "0,0,800,600"}, []string{}},
+		{"clip invalid", CaptureRule{Mode: CAPTURE_MODE_CLIP, Clip: "800x600"}, []string{"clip"}},
+		{"unknown mode", CaptureRule{Mode: "page"}, []string{"mode"}},
+	}
+
+	for _, test := range tests {
+		errs := validateCaptureRule(test.rule, "mode", "selector", "clip")
+		checkErrorFields(t, test.name, errs, test.want)
+	}
+}
+
+// testcapturefor checks that the first matching rule wins and the global settings apply otherwise
+func TestCaptureFor(t *testing.T) {
+	cfg := NewConfig("https://example.com")
+	cfg.CaptureMode = CAPTURE_MODE_VIEWPORT
+	cfg.CaptureRules = []CaptureRule{
+		{Pattern: "/Products", Mode: CAPTURE_MODE_ELEMENT, Selector: "#gallery"},
+		{Pattern: "/products/sale", Mode: CAPTURE_MODE_FULL},
+	}
+
+	if got := cfg.CaptureFor("https://example.com/products/sale"); got.Mode != CAPTURE_MODE_ELEMENT || got.Target() != "#gallery" {
+		t.Errorf("product rule = %+v, want the element rule", got)
+	}
+	if got := cfg.CaptureFor("https://example.com/about"); got != (CaptureRule{Mode: CAPTURE_MODE_VIEWPORT}) {
+		t.Errorf("global rule = %+v, want viewport mode", got)
+	}
+}
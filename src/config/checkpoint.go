@@ -0,0 +1,27 @@
+package config
+
+import "time"
+
+const (
+	CHECKPOINT_FILE             = "checkpoint.json"
+	DEFAULT_CHECKPOINT_INTERVAL = "30s"
+)
+
+// checkpointduration returns the parsed checkpoint interval, zero means the session is only
+// checkpointed when the crawl ends
+func (c *Config) CheckpointDuration() time.Duration {
+	return parseDuration(c.CheckpointEvery)
+}
+
+// validatecheckpoint checks that the checkpoint interval is either unset or a non-negative duration
+func (c *Config) validateCheckpoint() []error {
+	var errs []error
+
+	if c.CheckpointEvery != "" {
+		if interval, err := time.ParseDuration(c.CheckpointEvery); err != nil || interval < 0 {
+			errs = append(errs, fieldErrorf("checkpointInterval", "checkpoint interval must be a duration, e.g. 30s, or 0 to only checkpoint at the end"))
+		}
+	}
+
+	return errs
+}
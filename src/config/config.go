@@ -1,18 +1,43 @@
 package config
 
+import "time"
+
 const (
-	SCREENSHOTS_DIR   = "screenshots"
-	REPORT_FILE      = "report.json"
-	SUMMARY_FILE     = "summary.txt"
-	DEFAULT_MAX_DEPTH = 5
-	DEFAULT_PARALLEL_WORKERS = 5
-	DEFAULT_SCREENSHOT_DELAY = 3
-	DEFAULT_REQUEST_DELAY = 1
-	DEFAULT_VIEWPORT_WIDTH = 1920
-	DEFAULT_VIEWPORT_HEIGHT = 1080
+	SCREENSHOTS_DIR            = "screenshots"
+	REPORT_FILE                = "report.json"
+	SUMMARY_FILE               = "summary.txt"
+	DIFF_DIR                   = "diffs"
+	HISTORY_DIR                = "history"
+	HISTORY_TIME_FORMAT        = "20060102_150405.000"
+	RECAPTURE_NEVER            = "never"
+	RECAPTURE_ALWAYS           = "always"
+	RECAPTURE_OLDER_THAN       = "older-than"
+	RECAPTURE_IF_CHANGED       = "if-changed"
+	DEFAULT_RECAPTURE_POLICY   = RECAPTURE_NEVER
+	DIFF_REPORT_FILE           = "diff_report.json"
+	DIFF_SUMMARY_FILE          = "diff_summary.txt"
+	DEFAULT_DIFF_THRESHOLD     = 1.0
+	DIFF_PIXEL_TOLERANCE       = 16
+	DEFAULT_MAX_DEPTH          = 5
+	DEFAULT_PARALLEL_WORKERS   = 5
+	DEFAULT_SCREENSHOT_DELAY   = 3
+	DEFAULT_REQUEST_DELAY      = 1
+	DEFAULT_VIEWPORT_WIDTH     = 1920
+	DEFAULT_VIEWPORT_HEIGHT    = 1080
 	DEFAULT_SCREENSHOT_QUALITY = 90
-	DOMAIN_REGEX = `^[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
-	)
+	DEFAULT_TAB_RECYCLE_AFTER  = 50
+	IMAGE_FORMAT_PNG           = "png"
+	IMAGE_FORMAT_JPEG          = "jpeg"
+	IMAGE_FORMAT_WEBP          = "webp"
+	DEFAULT_IMAGE_FORMAT       = IMAGE_FORMAT_PNG
+	SITEMAP_MAX_URLS           = 50000
+	SITEMAP_MAX_BYTES          = 50 * 1024 * 1024
+	SITEMAP_MAX_NESTING        = 5
+	DEFAULT_SITEMAP_PRIORITY   = 0.5
+	MAX_CRAWL_DEPTH            = 10
+	MAX_PARALLEL_WORKERS       = 10
+	DOMAIN_REGEX               = `^[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
+)
 
 var (
 	EXCLUDED_EXTENSIONS = []string{
@@ -35,47 +60,135 @@ var (
 		"--no-first-run",
 		"--no-zygote",
 		"--disable-gpu",
-		"--disable-extensions",
 		"--disable-plugins",
-		"--disable-images",
-		"--disable-javascript",
 	}
 
 	DEFAULT_USER_AGENT = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
 )
 
-// config holds all configuration settings for the application
+// config holds all configuration settings for the application, the struct tags define
+// the keys used by profile files and the framely_ environment variable overrides
 type Config struct {
-	BaseURL          string
-	MaxDepth         int
-	ParallelWorkers  int
-	ScreenshotDelay  int
-	RequestDelay     int
-	ViewportWidth    int
-	ViewportHeight   int
-	Quality          int
-	CheckSitemap     bool
-	CheckRobots      bool
-	SkipPatterns     []string
-	UserAgent        string
-	OutputDir        string
+	BaseURL          string          `json:"url" yaml:"url" toml:"url"`
+	MaxDepth         int             `json:"maxDepth" yaml:"maxDepth" toml:"maxDepth"`
+	MaxPages         int             `json:"maxPages" yaml:"maxPages" toml:"maxPages"`
+	MaxPrefixPages   int             `json:"maxPagesPerPrefix" yaml:"maxPagesPerPrefix" toml:"maxPagesPerPrefix"`
+	ParallelWorkers  int             `json:"parallelWorkers" yaml:"parallelWorkers" toml:"parallelWorkers"`
+	ScreenshotDelay  int             `json:"screenshotDelay" yaml:"screenshotDelay" toml:"screenshotDelay"`
+	RequestDelay     int             `json:"requestDelay" yaml:"requestDelay" toml:"requestDelay"`
+	ViewportWidth    int             `json:"viewportWidth" yaml:"viewportWidth" toml:"viewportWidth"`
+	ViewportHeight   int             `json:"viewportHeight" yaml:"viewportHeight" toml:"viewportHeight"`
+	ImageFormat      string          `json:"imageFormat" yaml:"imageFormat" toml:"imageFormat"`
+	CaptureMode      string          `json:"captureMode" yaml:"captureMode" toml:"captureMode"`
+	CaptureSelector  string          `json:"captureSelector" yaml:"captureSelector" toml:"captureSelector"`
+	CaptureClip      string          `json:"captureClip" yaml:"captureClip" toml:"captureClip"`
+	CaptureRules     []CaptureRule   `json:"captureRules" yaml:"captureRules" toml:"captureRules"`
+	WaitStrategy     string          `json:"waitStrategy" yaml:"waitStrategy" toml:"waitStrategy"`
+	WaitSelector     string          `json:"waitSelector" yaml:"waitSelector" toml:"waitSelector"`
+	WaitExpression   string          `json:"waitExpression" yaml:"waitExpression" toml:"waitExpression"`
+	NetworkIdleTime  int             `json:"networkIdleTime" yaml:"networkIdleTime" toml:"networkIdleTime"`
+	WaitTimeout      string          `json:"waitTimeout" yaml:"waitTimeout" toml:"waitTimeout"`
+	WaitRules        []WaitRule      `json:"waitRules" yaml:"waitRules" toml:"waitRules"`
+	Quality          int             `json:"quality" yaml:"quality" toml:"quality"`
+	CheckSitemap     bool            `json:"checkSitemap" yaml:"checkSitemap" toml:"checkSitemap"`
+	CheckRobots      bool            `json:"checkRobots" yaml:"checkRobots" toml:"checkRobots"`
+	IgnoreRobots     bool            `json:"ignoreRobots" yaml:"ignoreRobots" toml:"ignoreRobots"`
+	SkipPatterns     []string        `json:"skipPatterns" yaml:"skipPatterns" toml:"skipPatterns"`
+	IncludeRules     []URLRule       `json:"includeRules" yaml:"includeRules" toml:"includeRules"`
+	ExcludeRules     []URLRule       `json:"excludeRules" yaml:"excludeRules" toml:"excludeRules"`
+	QueryAllow       []string        `json:"queryAllow" yaml:"queryAllow" toml:"queryAllow"`
+	QueryDeny        []string        `json:"queryDeny" yaml:"queryDeny" toml:"queryDeny"`
+	StripQuery       bool            `json:"stripQuery" yaml:"stripQuery" toml:"stripQuery"`
+	SortQuery        bool            `json:"sortQuery" yaml:"sortQuery" toml:"sortQuery"`
+	LowercaseHost    bool            `json:"lowercaseHost" yaml:"lowercaseHost" toml:"lowercaseHost"`
+	StripDefaultPort bool            `json:"stripDefaultPort" yaml:"stripDefaultPort" toml:"stripDefaultPort"`
+	IndexFiles       []string        `json:"indexFiles" yaml:"indexFiles" toml:"indexFiles"`
+	UserAgent        string          `json:"userAgent" yaml:"userAgent" toml:"userAgent"`
+	OutputDir        string          `json:"outputDir" yaml:"outputDir" toml:"outputDir"`
+	TabRecycleAfter  int             `json:"tabRecycleAfter" yaml:"tabRecycleAfter" toml:"tabRecycleAfter"`
+	EnableJavaScript bool            `json:"enableJavaScript" yaml:"enableJavaScript" toml:"enableJavaScript"`
+	EnableImages     bool            `json:"enableImages" yaml:"enableImages" toml:"enableImages"`
+	EnableExtensions bool            `json:"enableExtensions" yaml:"enableExtensions" toml:"enableExtensions"`
+	ChromeFlags      []string        `json:"chromeFlags" yaml:"chromeFlags" toml:"chromeFlags"`
+	ChromePath       string          `json:"chromePath" yaml:"chromePath" toml:"chromePath"`
+	FailOnHTTPError  bool            `json:"failOnHttpError" yaml:"failOnHttpError" toml:"failOnHttpError"`
+	PageLoadTimeout  string          `json:"pageLoadTimeout" yaml:"pageLoadTimeout" toml:"pageLoadTimeout"`
+	CaptureTimeout   string          `json:"captureTimeout" yaml:"captureTimeout" toml:"captureTimeout"`
+	CrawlTimeout     string          `json:"crawlTimeout" yaml:"crawlTimeout" toml:"crawlTimeout"`
+	ShutdownGrace    string          `json:"shutdownGrace" yaml:"shutdownGrace" toml:"shutdownGrace"`
+	Resume           bool            `json:"resume" yaml:"resume" toml:"resume"`
+	CheckpointEvery  string          `json:"checkpointInterval" yaml:"checkpointInterval" toml:"checkpointInterval"`
+	RetryAttempts    int             `json:"retryAttempts" yaml:"retryAttempts" toml:"retryAttempts"`
+	RetryBackoff     string          `json:"retryBackoff" yaml:"retryBackoff" toml:"retryBackoff"`
+	RetryMaxBackoff  string          `json:"retryMaxBackoff" yaml:"retryMaxBackoff" toml:"retryMaxBackoff"`
+	RecapturePolicy  string          `json:"recapturePolicy" yaml:"recapturePolicy" toml:"recapturePolicy"`
+	RecaptureAfter   string          `json:"recaptureAfter" yaml:"recaptureAfter" toml:"recaptureAfter"`
+	DiffBaseline     string          `json:"diffBaseline" yaml:"diffBaseline" toml:"diffBaseline"`
+	DiffThreshold    float64         `json:"diffThreshold" yaml:"diffThreshold" toml:"diffThreshold"`
+	Devices          []DeviceProfile `json:"devices" yaml:"devices" toml:"devices"`
 }
 
 // newconfig creates a new config instance with default values and the given baseurl
 func NewConfig(baseURL string) *Config {
 	return &Config{
-		BaseURL:         baseURL,
-		MaxDepth:        DEFAULT_MAX_DEPTH,
-		ParallelWorkers: DEFAULT_PARALLEL_WORKERS,
-		ScreenshotDelay: DEFAULT_SCREENSHOT_DELAY,
-		RequestDelay:    DEFAULT_REQUEST_DELAY,
-		ViewportWidth:   DEFAULT_VIEWPORT_WIDTH,
-		ViewportHeight:  DEFAULT_VIEWPORT_HEIGHT,
-		Quality:         DEFAULT_SCREENSHOT_QUALITY,
-		CheckSitemap:    true,
-		CheckRobots:     true,
-		SkipPatterns:    DEFAULT_SKIP_PATTERNS,
-		UserAgent:       DEFAULT_USER_AGENT,
-		OutputDir:       SCREENSHOTS_DIR,
+		BaseURL:          baseURL,
+		MaxDepth:         DEFAULT_MAX_DEPTH,
+		ParallelWorkers:  DEFAULT_PARALLEL_WORKERS,
+		ScreenshotDelay:  DEFAULT_SCREENSHOT_DELAY,
+		RequestDelay:     DEFAULT_REQUEST_DELAY,
+		ViewportWidth:    DEFAULT_VIEWPORT_WIDTH,
+		ViewportHeight:   DEFAULT_VIEWPORT_HEIGHT,
+		ImageFormat:      DEFAULT_IMAGE_FORMAT,
+		CaptureMode:      DEFAULT_CAPTURE_MODE,
+		CaptureRules:     make([]CaptureRule, 0),
+		WaitStrategy:     DEFAULT_WAIT_STRATEGY,
+		NetworkIdleTime:  DEFAULT_NETWORK_IDLE_TIME,
+		WaitTimeout:      DEFAULT_WAIT_TIMEOUT,
+		WaitRules:        make([]WaitRule, 0),
+		Quality:          DEFAULT_SCREENSHOT_QUALITY,
+		CheckSitemap:     true,
+		CheckRobots:      true,
+		SkipPatterns:     append([]string{}, DEFAULT_SKIP_PATTERNS...),
+		IncludeRules:     make([]URLRule, 0),
+		ExcludeRules:     make([]URLRule, 0),
+		QueryDeny:        append([]string{}, DEFAULT_QUERY_DENY...),
+		SortQuery:        true,
+		LowercaseHost:    true,
+		StripDefaultPort: true,
+		IndexFiles:       append([]string{}, DEFAULT_INDEX_FILES...),
+		UserAgent:        DEFAULT_USER_AGENT,
+		OutputDir:        SCREENSHOTS_DIR,
+		TabRecycleAfter:  DEFAULT_TAB_RECYCLE_AFTER,
+		EnableJavaScript: true,
+		EnableImages:     true,
+		EnableExtensions: false,
+		ChromeFlags:      make([]string, 0),
+		PageLoadTimeout:  DEFAULT_PAGE_LOAD_TIMEOUT,
+		CaptureTimeout:   DEFAULT_CAPTURE_TIMEOUT,
+		ShutdownGrace:    DEFAULT_SHUTDOWN_GRACE,
+		CheckpointEvery:  DEFAULT_CHECKPOINT_INTERVAL,
+		RetryAttempts:    DEFAULT_RETRY_ATTEMPTS,
+		RetryBackoff:     DEFAULT_RETRY_BACKOFF,
+		RetryMaxBackoff:  DEFAULT_RETRY_MAX_BACKOFF,
+		RecapturePolicy:  DEFAULT_RECAPTURE_POLICY,
+		DiffThreshold:    DEFAULT_DIFF_THRESHOLD,
+		Devices:          make([]DeviceProfile, 0),
 	}
 }
+
+// imageextension returns the file extension, including the dot, matching the configured image format
+func (c *Config) ImageExtension() string {
+	switch c.ImageFormat {
+	case IMAGE_FORMAT_JPEG:
+		return ".jpg"
+	case IMAGE_FORMAT_WEBP:
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
+
+// recaptureage returns the parsed recaptureafter duration, or zero when it is not set or invalid
+func (c *Config) RecaptureAge() time.Duration {
+	return parseDuration(c.RecaptureAfter)
+}
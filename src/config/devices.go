@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	DEFAULT_DEVICE_NAME      = "default"
+	MOBILE_SAFARI_USER_AGENT = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1"
+	IPAD_SAFARI_USER_AGENT   = "Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1"
+	ANDROID_USER_AGENT       = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Mobile Safari/537.36"
+)
+
+// deviceprofile describes the viewport and device emulation used for one capture of each page
+type DeviceProfile struct {
+	Name        string  `json:"name" yaml:"name" toml:"name"`
+	Width       int     `json:"width" yaml:"width" toml:"width"`
+	Height      int     `json:"height" yaml:"height" toml:"height"`
+	ScaleFactor float64 `json:"scaleFactor" yaml:"scaleFactor" toml:"scaleFactor"`
+	Mobile      bool    `json:"mobile" yaml:"mobile" toml:"mobile"`
+	Touch       bool    `json:"touch" yaml:"touch" toml:"touch"`
+	UserAgent   string  `json:"userAgent" yaml:"userAgent" toml:"userAgent"`
+}
+
+var DEVICE_PRESETS = map[string]DeviceProfile{
+	"desktop": {
+		Name:        "desktop",
+		Width:       DEFAULT_VIEWPORT_WIDTH,
+		Height:      DEFAULT_VIEWPORT_HEIGHT,
+		ScaleFactor: 1,
+	},
+	"laptop": {
+		Name:        "laptop",
+		Width:       1366,
+		Height:      768,
+		ScaleFactor: 1,
+	},
+	"tablet": {
+		Name:        "tablet",
+		Width:       820,
+		Height:      1180,
+		ScaleFactor: 2,
+		Mobile:      true,
+		Touch:       true,
+		UserAgent:   IPAD_SAFARI_USER_AGENT,
+	},
+	"iphone": {
+		Name:        "iphone",
+		Width:       390,
+		Height:      844,
+		ScaleFactor: 3,
+		Mobile:      true,
+		Touch:       true,
+		UserAgent:   MOBILE_SAFARI_USER_AGENT,
+	},
+	"android": {
+		Name:        "android",
+		Width:       412,
+		Height:      915,
+		ScaleFactor: 2.625,
+		Mobile:      true,
+		Touch:       true,
+		UserAgent:   ANDROID_USER_AGENT,
+	},
+}
+
+// lookupdevicepreset returns the preset with the given name, matched case-insensitively
+func LookupDevicePreset(name string) (DeviceProfile, error) {
+	preset, ok := DEVICE_PRESETS[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return DeviceProfile{}, fmt.Errorf("unknown device preset %q (available: %s)", name, strings.Join(DevicePresetNames(), ", "))
+	}
+	return preset, nil
+}
+
+// devicepresetnames returns the sorted names of all device presets
+func DevicePresetNames() []string {
+	names := make([]string, 0, len(DEVICE_PRESETS))
+	for name := range DEVICE_PRESETS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profiles returns the device profiles to capture each page with, a profile that only names a preset
+// is filled in from that preset, when no devices are configured a single untagged profile is built
+// from the viewport settings so filenames stay the same as a plain capture
+func (c *Config) Profiles() []DeviceProfile {
+	if len(c.Devices) == 0 {
+		return []DeviceProfile{{
+			Width:       c.ViewportWidth,
+			Height:      c.ViewportHeight,
+			ScaleFactor: 1,
+		}}
+	}
+
+	profiles := make([]DeviceProfile, 0, len(c.Devices))
+	for _, device := range c.Devices {
+		if device.Width == 0 && device.Height == 0 {
+			if preset, err := LookupDevicePreset(device.Name); err == nil {
+				device = preset
+			}
+		}
+		if device.ScaleFactor == 0 {
+			device.ScaleFactor = 1
+		}
+		profiles = append(profiles, device)
+	}
+
+	return profiles
+}
+
+// validatedevices checks every configured device profile and returns one error per problem
+func (c *Config) validateDevices() []error {
+	seen := make(map[string]bool)
+
+	return validateList("devices", c.Devices, func(device DeviceProfile) []error {
+		name := strings.TrimSpace(device.Name)
+		if name == "" {
+			return []error{fieldErrorf("name", "device name cannot be empty")}
+		}
+
+		var errs []error
+		if seen[strings.ToLower(name)] {
+			errs = append(errs, fieldErrorf("name", "duplicate device name %q", name))
+		}
+		seen[strings.ToLower(name)] = true
+
+		if device.Width == 0 && device.Height == 0 {
+			if _, err := LookupDevicePreset(name); err != nil {
+				errs = append(errs, &FieldError{Field: "name", Err: err})
+			}
+			return errs
+		}
+
+		if device.Width < 1 {
+			errs = append(errs, fieldErrorf("width", "device width must be positive"))
+		}
+		if device.Height < 1 {
+			errs = append(errs, fieldErrorf("height", "device height must be positive"))
+		}
+		if device.ScaleFactor < 0 {
+			errs = append(errs, fieldErrorf("scaleFactor", "scale factor cannot be negative"))
+		}
+		return errs
+	})
+}
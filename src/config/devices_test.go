@@ -0,0 +1,66 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testprofilesresolvespresets checks that devices naming only a preset are filled in from it,
+// case-insensitively, that custom devices keep their size with a default scale factor, and that
+// no devices yield one untagged profile from the viewport settings
+func TestProfilesResolvesPresets(t *testing.T) {
+	cfg := NewConfig("https://example.com")
+	cfg.ViewportWidth = 1440
+	cfg.ViewportHeight = 900
+
+	want := []DeviceProfile{{Width: 1440, Height: 900, ScaleFactor: 1}}
+	if got := cfg.Profiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("profiles without devices = %+v, want %+v", got, want)
+	}
+
+	cfg.Devices = []DeviceProfile{
+		{Name: "iPhone"},
+		{Name: "wide", Width: 2560, Height: 1440},
+		{Name: "tablet", Width: 600, Height: 800, ScaleFactor: 1.5},
+	}
+
+	want = []DeviceProfile{
+		DEVICE_PRESETS["iphone"],
+		{Name: "wide", Width: 2560, Height: 1440, ScaleFactor: 1},
+		{Name: "tablet", Width: 600, Height: 800, ScaleFactor: 1.5},
+	}
+	if got := cfg.Profiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("profiles = %+v, want %+v", got, want)
+	}
+}
+
+// testlookupdevicepreset checks that presets are found regardless of case and spacing and that an
+// unknown name is rejected
+func TestLookupDevicePreset(t *testing.T) {
+	preset, err := LookupDevicePreset(" Android ")
+	if err != nil {
+		t.Fatalf("lookup failed: %s", err)
+	}
+	if preset != DEVICE_PRESETS["android"] {
+		t.Errorf("preset = %+v, want the android preset", preset)
+	}
+
+	if _, err := LookupDevicePreset("watch"); err == nil {
+		t.Error("unknown preset was accepted")
+	}
+}
+
+// testvalidatedevices checks that unknown presets, duplicate names and bad sizes are reported per device
+func TestValidateDevices(t *testing.T) {
+	cfg := NewConfig("https://example.com")
+	cfg.Devices = []DeviceProfile{
+		{Name: "iphone"},
+		{Name: "IPhone"},
+		{Name: "watch"},
+		{Name: "custom", Width: 0, Height: 600, ScaleFactor: -1},
+		{Name: " "},
+	}
+
+	want := []string{"devices[1].name", "devices[2].name", "devices[3].width", "devices[3].scaleFactor", "devices[4].name"}
+	checkErrorFields(t, "validateDevices", cfg.validateDevices(), want)
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const ENV_PREFIX = "FRAMELY_"
+
+// loadfile reads a crawl profile from a yaml, json, or toml file, chosen by extension,
+// and decodes it on top of the defaults from newconfig, unknown keys are rejected
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := NewConfig("")
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("invalid YAML in %s: %w", path, err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", path, describeJSONError(err))
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOML in %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("invalid TOML in %s: unknown field %s", path, undecoded[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (use .yaml, .yml, .json or .toml)", filepath.Ext(path))
+	}
+
+	return cfg, nil
+}
+
+// describejsonerror rewrites json type errors so they name the offending field path
+func describeJSONError(err error) error {
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+		return fieldErrorf(typeErr.Field, "cannot use %s value as %s", typeErr.Value, typeErr.Type.String())
+	}
+	return err
+}
+
+// applyenv overrides config fields from framely_ environment variables, the variable name is
+// derived from the profile key, e.g. maxDepth becomes FRAMELY_MAX_DEPTH, list values are comma-separated
+func ApplyEnv(cfg *Config) error {
+	value := reflect.ValueOf(cfg).Elem()
+	fields := value.Type()
+
+	for i := 0; i < fields.NumField(); i++ {
+		key := strings.Split(fields.Field(i).Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		envName := EnvName(key)
+		raw, ok := os.LookupEnv(envName)
+		if !ok {
+			continue
+		}
+
+		if err := setFieldFromString(value.Field(i), raw); err != nil {
+			return &FieldError{Field: envName, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// envname converts a camelcase profile key into its framely_ environment variable name
+func EnvName(key string) string {
+	var sb strings.Builder
+	sb.WriteString(ENV_PREFIX)
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			sb.WriteRune('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// setfieldfromstring parses the raw string according to the field kind and stores it
+func setFieldFromString(field reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		field.SetFloat(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(parsed)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment, use a config file instead")
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			trimmed := strings.TrimSpace(item)
+			if trimmed != "" {
+				items = append(items, trimmed)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from the environment, use a config file instead")
+	}
+
+	return nil
+}
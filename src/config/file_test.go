@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testloadfileformats loads the same profile written as yaml, json and toml and checks that every
+// format sets the same fields and keeps the defaults of the keys it leaves out
+func TestLoadFileFormats(t *testing.T) {
+	profiles := map[string]string{
+		"framely.yaml": `url: example.com
+maxDepth: 3
+checkRobots: false
+skipPatterns: ["/admin", "/login"]
+requestDelay: 2
+`,
+		"framely.json": `{"url": "example.com", "maxDepth": 3, "checkRobots": false, "skipPatterns": ["/admin", "/login"], "requestDelay": 2}`,
+		"framely.toml": `url = "example.com"
+maxDepth = 3
+checkRobots = false
+skipPatterns = ["/admin", "/login"]
+requestDelay = 2
+`,
+	}
+
+	dir := t.TempDir()
+	for name, content := range profiles {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadFile(path)
+			if err != nil {
+				t.Fatalf("LoadFile error: %v", err)
+			}
+
+			if cfg.BaseURL != "example.com" || cfg.MaxDepth != 3 || cfg.CheckRobots || cfg.RequestDelay != 2 {
+				t.Errorf("loaded url %q, depth %d, robots %v, request delay %d", cfg.BaseURL, cfg.MaxDepth, cfg.CheckRobots, cfg.RequestDelay)
+			}
+			if !reflect.DeepEqual(cfg.SkipPatterns, []string{"/admin", "/login"}) {
+				t.Errorf("skip patterns = %v", cfg.SkipPatterns)
+			}
+			if cfg.ParallelWorkers != DEFAULT_PARALLEL_WORKERS || !cfg.CheckSitemap {
+				t.Errorf("defaults not kept: workers %d, sitemap %v", cfg.ParallelWorkers, cfg.CheckSitemap)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("loaded profile does not validate: %v", err)
+			}
+		})
+	}
+}
+
+// testloadfilerejectsunknownkeys checks that a misspelled key is an error in every format
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	profiles := map[string]string{
+		"typo.yaml": "maxDepht: 3\n",
+		"typo.json": `{"maxDepht": 3}`,
+		"typo.toml": "maxDepht = 3\n",
+	}
+
+	dir := t.TempDir()
+	for name, content := range profiles {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("LoadFile(%s) accepted an unknown key", name)
+		}
+	}
+}
+
+// testapplyenvoverrides checks framely_ overrides for int, bool, string and list fields,
+// and that an invalid value names the variable it came from
+func TestApplyEnvOverrides(t *testing.T) {
+	t.Setenv("FRAMELY_MAX_DEPTH", "7")
+	t.Setenv("FRAMELY_CHECK_SITEMAP", "false")
+	t.Setenv("FRAMELY_USER_AGENT", " framely-test ")
+	t.Setenv("FRAMELY_SKIP_PATTERNS", "/cart, /checkout,,")
+
+	cfg := NewConfig("example.com")
+	if err := ApplyEnv(cfg); err != nil {
+		t.Fatalf("ApplyEnv error: %v", err)
+	}
+
+	if cfg.MaxDepth != 7 {
+		t.Errorf("max depth = %d, want 7", cfg.MaxDepth)
+	}
+	if cfg.CheckSitemap {
+		t.Error("check sitemap is still enabled")
+	}
+	if cfg.UserAgent != "framely-test" {
+		t.Errorf("user agent = %q, want framely-test", cfg.UserAgent)
+	}
+	if !reflect.DeepEqual(cfg.SkipPatterns, []string{"/cart", "/checkout"}) {
+		t.Errorf("skip patterns = %v, want [/cart /checkout]", cfg.SkipPatterns)
+	}
+
+	t.Setenv("FRAMELY_PARALLEL_WORKERS", "many")
+	err := ApplyEnv(NewConfig("example.com"))
+	fieldErr, ok := err.(*FieldError)
+	if !ok || fieldErr.Field != "FRAMELY_PARALLEL_WORKERS" {
+		t.Fatalf("ApplyEnv error = %v, want a field error for FRAMELY_PARALLEL_WORKERS", err)
+	}
+}
+
+// testenvname checks the conversion from profile keys to environment variable names
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"maxDepth":        "FRAMELY_MAX_DEPTH",
+		"url":             "FRAMELY_URL",
+		"failOnHttpError": "FRAMELY_FAIL_ON_HTTP_ERROR",
+	}
+	for key, want := range tests {
+		if got := EnvName(key); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+var (
+	DEFAULT_QUERY_DENY = []string{
+		"utm_*",
+		"fbclid",
+		"gclid",
+	}
+
+	DEFAULT_INDEX_FILES = []string{
+		"index.html",
+		"index.htm",
+	}
+)
+
+// urlpolicy decides which urls count as the same page, it is applied when deduplicating the crawl queue,
+// naming screenshot files and merging report results, it is stored in report.json so later diffs pair pages the same way
+type URLPolicy struct {
+	QueryAllow       []string `json:"queryAllow,omitempty"`
+	QueryDeny        []string `json:"queryDeny,omitempty"`
+	StripQuery       bool     `json:"stripQuery"`
+	SortQuery        bool     `json:"sortQuery"`
+	LowercaseHost    bool     `json:"lowercaseHost"`
+	StripDefaultPort bool     `json:"stripDefaultPort"`
+	IndexFiles       []string `json:"indexFiles,omitempty"`
+}
+
+// defaulturlpolicy returns the policy used when no config is loaded, e.g. by the diff command
+func DefaultURLPolicy() URLPolicy {
+	return URLPolicy{
+		QueryDeny:        DEFAULT_QUERY_DENY,
+		SortQuery:        true,
+		LowercaseHost:    true,
+		StripDefaultPort: true,
+		IndexFiles:       DEFAULT_INDEX_FILES,
+	}
+}
+
+// legacyurlpolicy returns the policy reports were written with before the policy was stored in report.json,
+// it dropped the whole query string and left the host, port and index files as they were
+func LegacyURLPolicy() URLPolicy {
+	return URLPolicy{StripQuery: true}
+}
+
+// urlpolicy returns the url normalization policy of the config
+func (c *Config) URLPolicy() URLPolicy {
+	return URLPolicy{
+		QueryAllow:       c.QueryAllow,
+		QueryDeny:        c.QueryDeny,
+		StripQuery:       c.StripQuery,
+		SortQuery:        c.SortQuery,
+		LowercaseHost:    c.LowercaseHost,
+		StripDefaultPort: c.StripDefaultPort,
+		IndexFiles:       c.IndexFiles,
+	}
+}
+
+// equal reports whether both policies normalize every url the same way
+func (p URLPolicy) Equal(other URLPolicy) bool {
+	return slices.Equal(p.QueryAllow, other.QueryAllow) &&
+		slices.Equal(p.QueryDeny, other.QueryDeny) &&
+		p.StripQuery == other.StripQuery &&
+		p.SortQuery == other.SortQuery &&
+		p.LowercaseHost == other.LowercaseHost &&
+		p.StripDefaultPort == other.StripDefaultPort &&
+		slices.Equal(p.IndexFiles, other.IndexFiles)
+}
+
+// keepsqueryparam reports whether a query parameter is part of the page identity, a parameter is kept
+// when the allow list is empty or matches it and the deny list does not, patterns may use * wildcards
+// and match case-insensitively
+func (p URLPolicy) KeepsQueryParam(name string) bool {
+	if p.StripQuery {
+		return false
+	}
+	if len(p.QueryAllow) > 0 && !matchesQueryPattern(p.QueryAllow, name) {
+		return false
+	}
+	return !matchesQueryPattern(p.QueryDeny, name)
+}
+
+// matchesquerypattern reports whether the parameter name matches any of the patterns
+func matchesQueryPattern(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validatenormalization checks that the query patterns are valid wildcard patterns and that the index
+// files are plain file names
+func (c *Config) validateNormalization() []error {
+	errs := validateList("queryAllow", c.QueryAllow, validateQueryPattern)
+	errs = append(errs, validateList("queryDeny", c.QueryDeny, validateQueryPattern)...)
+
+	return append(errs, validateList("indexFiles", c.IndexFiles, func(file string) []error {
+		if strings.TrimSpace(file) == "" || strings.Contains(file, "/") {
+			return []error{fmt.Errorf("index file must be a file name, e.g. index.html")}
+		}
+		return nil
+	})...)
+}
+
+// validatequerypattern checks that a query parameter pattern is a valid wildcard pattern
+func validateQueryPattern(pattern string) []error {
+	if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+		return []error{fmt.Errorf("invalid query parameter pattern %q", pattern)}
+	}
+	return nil
+}
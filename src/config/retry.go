@@ -0,0 +1,45 @@
+package config
+
+import "time"
+
+const (
+	DEFAULT_RETRY_ATTEMPTS    = 3
+	DEFAULT_RETRY_BACKOFF     = "1s"
+	DEFAULT_RETRY_MAX_BACKOFF = "30s"
+	MAX_RETRY_ATTEMPTS        = 10
+)
+
+// retrybackoffbase returns the parsed delay before the first retry, or zero when it is invalid
+func (c *Config) RetryBackoffBase() time.Duration {
+	return parseDuration(c.RetryBackoff)
+}
+
+// retrybackoffmax returns the parsed upper bound of the retry delay, or zero when it is invalid
+func (c *Config) RetryBackoffMax() time.Duration {
+	return parseDuration(c.RetryMaxBackoff)
+}
+
+// validateretry checks the attempt count and that both backoff durations parse and are ordered
+func (c *Config) validateRetry() []error {
+	var errs []error
+
+	if c.RetryAttempts < 1 || c.RetryAttempts > MAX_RETRY_ATTEMPTS {
+		errs = append(errs, fieldErrorf("retryAttempts", "retry attempts must be between 1 and %d", MAX_RETRY_ATTEMPTS))
+	}
+
+	base, err := time.ParseDuration(c.RetryBackoff)
+	if err != nil || base < 0 {
+		errs = append(errs, fieldErrorf("retryBackoff", "retry backoff must be a duration, e.g. 500ms or 2s"))
+	}
+
+	maximum, maxErr := time.ParseDuration(c.RetryMaxBackoff)
+	if maxErr != nil || maximum < 0 {
+		errs = append(errs, fieldErrorf("retryMaxBackoff", "retry max backoff must be a duration, e.g. 30s"))
+	}
+
+	if err == nil && maxErr == nil && maximum < base {
+		errs = append(errs, fieldErrorf("retryMaxBackoff", "retry max backoff cannot be shorter than the retry backoff"))
+	}
+
+	return errs
+}
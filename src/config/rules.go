@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	RULE_TYPE_GLOB     = "glob"
+	RULE_TYPE_REGEX    = "regex"
+	RULE_MATCH_PATH    = "path"
+	RULE_MATCH_QUERY   = "query"
+	RULE_MATCH_URL     = "url"
+	DEFAULT_RULE_TYPE  = RULE_TYPE_GLOB
+	DEFAULT_RULE_MATCH = RULE_MATCH_PATH
+)
+
+// urlrule matches urls by a glob or regex pattern against the path, the query or the full normalized url,
+// globs match the whole value where * stays within one path segment, ** crosses segments and a trailing /**
+// also matches the directory itself, regexes match anywhere unless anchored
+type URLRule struct {
+	Pattern string `json:"pattern" yaml:"pattern" toml:"pattern"`
+	Type    string `json:"type" yaml:"type" toml:"type"`
+	Match   string `json:"match" yaml:"match" toml:"match"`
+}
+
+// parseurlrule parses a rule in [type:][match:]pattern format, e.g. /docs/**, regex:/print$ or
+// regex:query:^lang=, the type and match parts are optional and default to glob and path
+func ParseURLRule(value string) (URLRule, error) {
+	rule := URLRule{Type: DEFAULT_RULE_TYPE, Match: DEFAULT_RULE_MATCH}
+	rest := strings.TrimSpace(value)
+
+	if prefix, pattern, ok := strings.Cut(rest, ":"); ok && (prefix == RULE_TYPE_GLOB || prefix == RULE_TYPE_REGEX) {
+		rule.Type = prefix
+		rest = pattern
+	}
+
+	if prefix, pattern, ok := strings.Cut(rest, ":"); ok && (prefix == RULE_MATCH_PATH || prefix == RULE_MATCH_QUERY || prefix == RULE_MATCH_URL) {
+		rule.Match = prefix
+		rest = pattern
+	}
+
+	rule.Pattern = rest
+	if _, err := rule.Compile(); err != nil {
+		return URLRule{}, err
+	}
+
+	return rule, nil
+}
+
+// string formats the rule in the same [type:][match:]pattern format parseurlrule reads
+func (r URLRule) String() string {
+	return r.ruleType() + ":" + r.match() + ":" + r.Pattern
+}
+
+// ruletype returns the rule type, an empty type means glob
+func (r URLRule) ruleType() string {
+	if r.Type == "" {
+		return DEFAULT_RULE_TYPE
+	}
+	return r.Type
+}
+
+// match returns the part of the url the rule matches, an empty match means path
+func (r URLRule) match() string {
+	if r.Match == "" {
+		return DEFAULT_RULE_MATCH
+	}
+	return r.Match
+}
+
+// target returns the part of the url the rule is matched against, the url must already be normalized
+func (r URLRule) Target(path, query, url string) string {
+	switch r.match() {
+	case RULE_MATCH_QUERY:
+		return query
+	case RULE_MATCH_URL:
+		return url
+	default:
+		return path
+	}
+}
+
+// compile turns the rule into a regular expression, globs are translated and anchored
+func (r URLRule) Compile() (*regexp.Regexp, error) {
+	if strings.TrimSpace(r.Pattern) == "" {
+		return nil, fmt.Errorf("rule pattern cannot be empty")
+	}
+
+	switch r.match() {
+	case RULE_MATCH_PATH, RULE_MATCH_QUERY, RULE_MATCH_URL:
+	default:
+		return nil, fmt.Errorf("rule match must be one of path, query, url")
+	}
+
+	switch r.ruleType() {
+	case RULE_TYPE_GLOB:
+		return regexp.Compile(globToRegexp(r.Pattern))
+	case RULE_TYPE_REGEX:
+		return regexp.Compile(r.Pattern)
+	default:
+		return nil, fmt.Errorf("rule type must be one of glob, regex")
+	}
+}
+
+// globtoregexp translates a glob into an anchored regular expression
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			sb.WriteString("[^/]*")
+		case glob[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// validaterules checks that every include and exclude rule has a known type and match and compiles
+func (c *Config) validateRules() []error {
+	errs := validateList("includeRules", c.IncludeRules, validateURLRule)
+	return append(errs, validateList("excludeRules", c.ExcludeRules, validateURLRule)...)
+}
+
+// validateurlrule checks that one rule compiles
+func validateURLRule(rule URLRule) []error {
+	if _, err := rule.Compile(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
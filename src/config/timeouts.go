@@ -0,0 +1,67 @@
+package config
+
+import "time"
+
+const (
+	DEFAULT_PAGE_LOAD_TIMEOUT = "30s"
+	DEFAULT_CAPTURE_TIMEOUT   = "60s"
+	DEFAULT_SHUTDOWN_GRACE    = "30s"
+)
+
+// pageloadduration returns the parsed page load timeout, or zero when it is invalid
+func (c *Config) PageLoadDuration() time.Duration {
+	return parseDuration(c.PageLoadTimeout)
+}
+
+// captureduration returns the parsed capture timeout, or zero when it is invalid
+func (c *Config) CaptureDuration() time.Duration {
+	return parseDuration(c.CaptureTimeout)
+}
+
+// crawlduration returns the parsed overall crawl timeout, zero means the crawl has no time limit
+func (c *Config) CrawlDuration() time.Duration {
+	return parseDuration(c.CrawlTimeout)
+}
+
+// shutdowngraceduration returns the parsed time pages in progress get to finish after an interrupt,
+// zero interrupts them right away
+func (c *Config) ShutdownGraceDuration() time.Duration {
+	return parseDuration(c.ShutdownGrace)
+}
+
+// parseduration parses a duration setting, an empty or invalid value counts as zero
+func parseDuration(value string) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// validatetimeouts checks that the page load and capture timeouts are positive durations and that
+// the crawl timeout and shutdown grace period are either unset or non-negative durations
+func (c *Config) validateTimeouts() []error {
+	var errs []error
+
+	if timeout, err := time.ParseDuration(c.PageLoadTimeout); err != nil || timeout <= 0 {
+		errs = append(errs, fieldErrorf("pageLoadTimeout", "page load timeout must be a positive duration, e.g. 30s"))
+	}
+
+	if timeout, err := time.ParseDuration(c.CaptureTimeout); err != nil || timeout <= 0 {
+		errs = append(errs, fieldErrorf("captureTimeout", "capture timeout must be a positive duration, e.g. 60s"))
+	}
+
+	if c.CrawlTimeout != "" {
+		if timeout, err := time.ParseDuration(c.CrawlTimeout); err != nil || timeout < 0 {
+			errs = append(errs, fieldErrorf("crawlTimeout", "crawl timeout must be a duration, e.g. 2h, or 0 for no limit"))
+		}
+	}
+
+	if c.ShutdownGrace != "" {
+		if grace, err := time.ParseDuration(c.ShutdownGrace); err != nil || grace < 0 {
+			errs = append(errs, fieldErrorf("shutdownGrace", "shutdown grace period must be a duration, e.g. 30s, or 0 to stop right away"))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validatebaseurl trims the raw target url, adds https if no scheme is given, and checks
+// that it parses and has a host matching the domain regex, it returns the cleaned url
+func ValidateBaseURL(raw string) (string, error) {
+	targetURL := strings.TrimSpace(raw)
+	if targetURL == "" {
+		return "", fmt.Errorf("URL cannot be empty")
+	}
+
+	if !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://") {
+		targetURL = "https://" + targetURL
+	}
+
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL format: %w", err)
+	}
+
+	host := u.Host
+	if host == "" {
+		return "", fmt.Errorf("URL must have a host")
+	}
+
+	matched, err := regexp.MatchString(DOMAIN_REGEX, host)
+	if err != nil {
+		return "", fmt.Errorf("regex error: %w", err)
+	}
+	if !matched {
+		return "", fmt.Errorf("invalid domain format")
+	}
+
+	return targetURL, nil
+}
+
+// validatedepth checks that the crawl depth is between 1 and max_crawl_depth
+func ValidateDepth(depth int) error {
+	if depth < 1 {
+		return fmt.Errorf("depth must be at least 1")
+	}
+	if depth > MAX_CRAWL_DEPTH {
+		return fmt.Errorf("depth cannot exceed %d for safety", MAX_CRAWL_DEPTH)
+	}
+	return nil
+}
+
+// validateworkercount checks that the worker count is between 1 and max_parallel_workers
+func ValidateWorkerCount(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("worker count must be at least 1")
+	}
+	if workers > MAX_PARALLEL_WORKERS {
+		return fmt.Errorf("worker count cannot exceed %d for safety", MAX_PARALLEL_WORKERS)
+	}
+	return nil
+}
+
+// parseviewport parses a viewport string in the form widthxheight, e.g. 1366x768
+func ParseViewport(value string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(value)), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("viewport must be in WIDTHxHEIGHT format")
+	}
+
+	width, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid viewport width: %w", err)
+	}
+
+	height, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid viewport height: %w", err)
+	}
+
+	if width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("viewport dimensions must be positive")
+	}
+
+	return width, height, nil
+}
+
+// validatediffthreshold checks that the diff threshold is a percentage between 0 and 100
+func ValidateDiffThreshold(threshold float64) error {
+	if threshold < 0 || threshold > 100 {
+		return fmt.Errorf("diff threshold must be between 0 and 100 percent")
+	}
+	return nil
+}
+
+// fielderror describes a validation failure for a single config field, identified by its
+// profile file key path, e.g. maxDepth or skipPatterns[1]
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// error formats the field error as path: message
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", fe.Field, fe.Err.Error())
+}
+
+// unwrap returns the underlying validation error
+func (fe *FieldError) Unwrap() error {
+	return fe.Err
+}
+
+// fielderrorf creates a field error for the given path with a formatted message
+func fieldErrorf(field, format string, args ...any) *FieldError {
+	return &FieldError{Field: field, Err: fmt.Errorf(format, args...)}
+}
+
+// validatelist checks every item of a list field with check and places the errors it returns under the
+// item path, e.g. waitRules[2], an error check reports for a sub-field such as selector becomes
+// waitRules[2].selector
+func validateList[T any](field string, items []T, check func(item T) []error) []error {
+	var errs []error
+
+	for i, item := range items {
+		path := fmt.Sprintf("%s[%d]", field, i)
+		for _, err := range check(item) {
+			if fieldErr, ok := err.(*FieldError); ok {
+				errs = append(errs, &FieldError{Field: path + "." + fieldErr.Field, Err: fieldErr.Err})
+			} else {
+				errs = append(errs, &FieldError{Field: path, Err: err})
+			}
+		}
+	}
+
+	return errs
+}
+
+// validate checks every field of the config with the same rules used by the interactive prompts,
+// it also cleans the base url and image format in place so callers get the same values the prompts would produce,
+// all failures are returned together, each one prefixed with its field path
+func (c *Config) Validate() error {
+	var errs []error
+
+	baseURL, err := ValidateBaseURL(c.BaseURL)
+	if err != nil {
+		errs = append(errs, &FieldError{Field: "url", Err: err})
+	}
+	if err == nil {
+		c.BaseURL = baseURL
+	}
+
+	if err := ValidateDepth(c.MaxDepth); err != nil {
+		errs = append(errs, &FieldError{Field: "maxDepth", Err: err})
+	}
+
+	if c.MaxPages < 0 {
+		errs = append(errs, fieldErrorf("maxPages", "page limit cannot be negative"))
+	}
+
+	if c.MaxPrefixPages < 0 {
+		errs = append(errs, fieldErrorf("maxPagesPerPrefix", "page limit per path prefix cannot be negative"))
+	}
+
+	if err := ValidateWorkerCount(c.ParallelWorkers); err != nil {
+		errs = append(errs, &FieldError{Field: "parallelWorkers", Err: err})
+	}
+
+	if c.ScreenshotDelay < 0 {
+		errs = append(errs, fieldErrorf("screenshotDelay", "screenshot delay cannot be negative"))
+	}
+
+	if c.RequestDelay < 0 {
+		errs = append(errs, fieldErrorf("requestDelay", "request delay cannot be negative"))
+	}
+
+	if c.ViewportWidth < 1 {
+		errs = append(errs, fieldErrorf("viewportWidth", "viewport width must be positive"))
+	}
+
+	if c.ViewportHeight < 1 {
+		errs = append(errs, fieldErrorf("viewportHeight", "viewport height must be positive"))
+	}
+
+	format := strings.ToLower(strings.TrimSpace(c.ImageFormat))
+	if format == "jpg" {
+		format = IMAGE_FORMAT_JPEG
+	}
+	switch format {
+	case IMAGE_FORMAT_PNG, IMAGE_FORMAT_JPEG, IMAGE_FORMAT_WEBP:
+		c.ImageFormat = format
+	default:
+		errs = append(errs, fieldErrorf("imageFormat", "image format must be one of png, jpeg, webp"))
+	}
+
+	if c.Quality < 1 || c.Quality > 100 {
+		errs = append(errs, fieldErrorf("quality", "quality must be between 1 and 100"))
+	}
+
+	errs = append(errs, validateList("skipPatterns", c.SkipPatterns, func(pattern string) []error {
+		if strings.TrimSpace(pattern) == "" {
+			return []error{fmt.Errorf("skip pattern cannot be empty")}
+		}
+		return nil
+	})...)
+
+	if strings.TrimSpace(c.UserAgent) == "" {
+		errs = append(errs, fieldErrorf("userAgent", "user agent cannot be empty"))
+	}
+
+	if strings.TrimSpace(c.OutputDir) == "" {
+		errs = append(errs, fieldErrorf("outputDir", "output directory cannot be empty"))
+	}
+
+	if c.TabRecycleAfter < 0 {
+		errs = append(errs, fieldErrorf("tabRecycleAfter", "tab recycle count cannot be negative"))
+	}
+
+	errs = append(errs, validateList("chromeFlags", c.ChromeFlags, func(flag string) []error {
+		if !strings.HasPrefix(flag, "--") || strings.TrimPrefix(flag, "--") == "" {
+			return []error{fmt.Errorf("chrome flag %q must start with --", flag)}
+		}
+		return nil
+	})...)
+
+	if c.ChromePath != "" {
+		if _, err := os.Stat(c.ChromePath); err != nil {
+			errs = append(errs, fieldErrorf("chromePath", "chrome binary not found: %s", c.ChromePath))
+		}
+	}
+
+	switch c.RecapturePolicy {
+	case RECAPTURE_NEVER, RECAPTURE_ALWAYS, RECAPTURE_IF_CHANGED:
+	case RECAPTURE_OLDER_THAN:
+		age, err := time.ParseDuration(c.RecaptureAfter)
+		if err != nil || age <= 0 {
+			errs = append(errs, fieldErrorf("recaptureAfter", "older-than recapture needs a positive duration, e.g. 72h"))
+		}
+	default:
+		errs = append(errs, fieldErrorf("recapturePolicy", "recapture policy must be one of never, always, older-than, if-changed"))
+	}
+
+	if err := ValidateDiffThreshold(c.DiffThreshold); err != nil {
+		errs = append(errs, &FieldError{Field: "diffThreshold", Err: err})
+	}
+
+	if c.DiffBaseline != "" {
+		if _, err := os.Stat(c.DiffBaseline); err != nil {
+			errs = append(errs, fieldErrorf("diffBaseline", "baseline directory not found: %s", c.DiffBaseline))
+		}
+	}
+
+	errs = append(errs, c.validateDevices()...)
+	errs = append(errs, c.validateCapture()...)
+	errs = append(errs, c.validateWait()...)
+	errs = append(errs, c.validateRetry()...)
+	errs = append(errs, c.validateTimeouts()...)
+	errs = append(errs, c.validateCheckpoint()...)
+	errs = append(errs, c.validateNormalization()...)
+	errs = append(errs, c.validateRules()...)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// errorfields returns the field of every field error in errs, in order
+func errorFields(t *testing.T, errs []error) []string {
+	t.Helper()
+
+	fields := make([]string, 0, len(errs))
+	for _, err := range errs {
+		var target *FieldError
+		if !errors.As(err, &target) {
+			t.Fatalf("error %q is not a field error", err)
+		}
+		fields = append(fields, target.Field)
+	}
+	return fields
+}
+
+// checkerrorfields reports an error for the named case when errs do not name exactly the wanted fields, in order
+func checkErrorFields(t *testing.T, name string, errs []error, want []string) {
+	t.Helper()
+
+	if got := errorFields(t, errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: fields = %v, want %v", name, got, want)
+	}
+}
+
+// testvalidatereportseveryfield breaks several fields at once and checks that validate returns one
+// field error per problem, each with its profile key path
+func TestValidateReportsEveryField(t *testing.T) {
+	cfg := NewConfig("not a url")
+	cfg.MaxDepth = 0
+	cfg.Quality = 101
+	cfg.SkipPatterns = []string{"/admin", " "}
+	cfg.ViewportWidth = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config passed validation")
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("validate error %T does not join its errors", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, field := range errorFields(t, joined.Unwrap()) {
+		fields[field] = true
+	}
+
+	for _, want := range []string{"url", "maxDepth", "quality", "skipPatterns[1]", "viewportWidth"} {
+		if !fields[want] {
+			t.Errorf("no error for %s, got %v", want, fields)
+		}
+	}
+	if len(fields) != 5 {
+		t.Errorf("got errors for %v, want exactly 5 fields", fields)
+	}
+}
+
+// testvalidatecleansvalues checks that a valid config is accepted and normalized in place
+func TestValidateCleansValues(t *testing.T) {
+	cfg := NewConfig("example.com")
+	cfg.ImageFormat = "JPG"
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("valid config failed validation: %v", err)
+	}
+	if cfg.BaseURL != "https://example.com" {
+		t.Errorf("base url = %q, want https://example.com", cfg.BaseURL)
+	}
+	if cfg.ImageFormat != IMAGE_FORMAT_JPEG {
+		t.Errorf("image format = %q, want jpeg", cfg.ImageFormat)
+	}
+}
+
+// testvalidatelist checks that item errors are placed under the item path and sub-field errors below it
+func TestValidateList(t *testing.T) {
+	check := func(value int) []error {
+		switch {
+		case value < 0:
+			return []error{fmt.Errorf("value cannot be negative")}
+		case value > 10:
+			return []error{fieldErrorf("max", "value too large"), fieldErrorf("min", "value too large")}
+		}
+		return nil
+	}
+
+	errs := validateList("values", []int{1, -1, 11}, check)
+	checkErrorFields(t, "validateList", errs, []string{"values[1]", "values[2].max", "values[2].min"})
+
+	if errs[0].Error() != "values[1]: value cannot be negative" {
+		t.Errorf("error = %q, want the item path and message", errs[0])
+	}
+	if len(validateList("values", nil, check)) != 0 {
+		t.Error("empty list reported errors")
+	}
+}
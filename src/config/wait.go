@@ -0,0 +1,102 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	WAIT_DELAY                = "delay"
+	WAIT_NETWORK_IDLE         = "network-idle"
+	WAIT_SELECTOR             = "selector"
+	WAIT_EXPRESSION           = "expression"
+	WAIT_LOAD                 = "load"
+	WAIT_DOM_CONTENT_LOADED   = "domcontentloaded"
+	WAIT_RESOURCES            = "resources"
+	DEFAULT_WAIT_STRATEGY     = WAIT_DELAY
+	DEFAULT_NETWORK_IDLE_TIME = 500
+	DEFAULT_WAIT_TIMEOUT      = "10s"
+)
+
+// waitrule selects how a page is considered ready before its screenshot, rules with a pattern apply
+// to urls containing that pattern case-insensitively, the same way capture rules match
+type WaitRule struct {
+	Pattern    string `json:"pattern" yaml:"pattern" toml:"pattern"`
+	Strategy   string `json:"strategy" yaml:"strategy" toml:"strategy"`
+	Selector   string `json:"selector" yaml:"selector" toml:"selector"`
+	Expression string `json:"expression" yaml:"expression" toml:"expression"`
+	IdleTime   int    `json:"idleTime" yaml:"idleTime" toml:"idleTime"`
+}
+
+// waitfor returns the wait rule for the url, the first matching per-url rule wins, otherwise the
+// global wait settings are used, a rule without an idle time uses the global one
+func (c *Config) WaitFor(url string) WaitRule {
+	lowerURL := strings.ToLower(url)
+	for _, rule := range c.WaitRules {
+		if strings.Contains(lowerURL, strings.ToLower(rule.Pattern)) {
+			if rule.IdleTime == 0 {
+				rule.IdleTime = c.NetworkIdleTime
+			}
+			return rule
+		}
+	}
+
+	return WaitRule{
+		Strategy:   c.WaitStrategy,
+		Selector:   c.WaitSelector,
+		Expression: c.WaitExpression,
+		IdleTime:   c.NetworkIdleTime,
+	}
+}
+
+// waitduration returns the parsed wait timeout, after which the fixed screenshot delay is used instead
+func (c *Config) WaitDuration() time.Duration {
+	return parseDuration(c.WaitTimeout)
+}
+
+// validatewaitrule checks that a rule has a known strategy and the selector or expression that strategy needs
+func validateWaitRule(rule WaitRule, strategyField, selectorField, expressionField, idleField string) []error {
+	var errs []error
+
+	switch rule.Strategy {
+	case WAIT_DELAY, WAIT_NETWORK_IDLE, WAIT_LOAD, WAIT_DOM_CONTENT_LOADED, WAIT_RESOURCES:
+	case WAIT_SELECTOR:
+		if strings.TrimSpace(rule.Selector) == "" {
+			errs = append(errs, fieldErrorf(selectorField, "selector wait needs a CSS selector"))
+		}
+	case WAIT_EXPRESSION:
+		if strings.TrimSpace(rule.Expression) == "" {
+			errs = append(errs, fieldErrorf(expressionField, "expression wait needs a JavaScript expression"))
+		}
+	default:
+		errs = append(errs, fieldErrorf(strategyField, "wait strategy must be one of delay, network-idle, selector, expression, load, domcontentloaded, resources"))
+	}
+
+	if rule.IdleTime < 0 {
+		errs = append(errs, fieldErrorf(idleField, "network idle time cannot be negative"))
+	}
+
+	return errs
+}
+
+// validatewait checks the global wait settings, the wait timeout and every per-url wait rule
+func (c *Config) validateWait() []error {
+	errs := validateWaitRule(WaitRule{
+		Strategy:   c.WaitStrategy,
+		Selector:   c.WaitSelector,
+		Expression: c.WaitExpression,
+		IdleTime:   c.NetworkIdleTime,
+	}, "waitStrategy", "waitSelector", "waitExpression", "networkIdleTime")
+
+	if timeout, err := time.ParseDuration(c.WaitTimeout); err != nil || timeout <= 0 {
+		errs = append(errs, fieldErrorf("waitTimeout", "wait timeout must be a positive duration, e.g. 10s"))
+	}
+
+	return append(errs, validateList("waitRules", c.WaitRules, func(rule WaitRule) []error {
+		var errs []error
+		if strings.TrimSpace(rule.Pattern) == "" {
+			errs = append(errs, fieldErrorf("pattern", "wait rule pattern cannot be empty"))
+		}
+		return append(errs, validateWaitRule(rule, "strategy", "selector", "expression", "idleTime")...)
+	})...)
+}
@@ -0,0 +1,73 @@
+package config
+
+import "testing"
+
+// testvalidatewaitrule checks every wait strategy together with the selector or expression it needs
+func TestValidateWaitRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule WaitRule
+		want []string
+	}{
+		{"delay", WaitRule{Strategy: WAIT_DELAY}, []string{}},
+		{"network idle", WaitRule{Strategy: WAIT_NETWORK_IDLE, IdleTime: 500}, []string{}},
+		{"load", WaitRule{Strategy: WAIT_LOAD}, []string{}},
+		{"domcontentloaded", WaitRule{Strategy: WAIT_DOM_CONTENT_LOADED}, []string{}},
+		{"resources", WaitRule{Strategy: WAIT_RESOURCES}, []string{}},
+		{"selector", WaitRule{Strategy: WAIT_SELECTOR, Selector: "#app"}, []string{}},
+		{"selector missing", WaitRule{Strategy: WAIT_SELECTOR, Selector: " "}, []string{"selector"}},
+		{"expression", WaitRule{Strategy: WAIT_EXPRESSION, Expression: "window.ready"}, []string{}},
+		{"expression missing", WaitRule{Strategy: WAIT_EXPRESSION}, []string{"expression"}},
+		{"unknown strategy", WaitRule{Strategy: "idle"}, []string{"strategy"}},
+		{"strategy case", WaitRule{Strategy: "Load"}, []string{"strategy"}},
+		{"negative idle time", WaitRule{Strategy: WAIT_NETWORK_IDLE, IdleTime: -1}, []string{"idle"}},
+	}
+
+	for _, test := range tests {
+		errs := validateWaitRule(test.rule, "strategy", "selector", "expression", "idle")
+		checkErrorFields(t, test.name, errs, test.want)
+	}
+}
+
+// testvalidatewaitprefixesrules checks that the global settings, the timeout and the per-url rules
+// are validated with their own field paths
+func TestValidateWaitPrefixesRules(t *testing.T) {
+	cfg := NewConfig("https://example.com")
+	cfg.WaitStrategy = WAIT_SELECTOR
+	cfg.WaitTimeout = "0s"
+	cfg.WaitRules = []WaitRule{
+		{Pattern: "/blog", Strategy: WAIT_LOAD},
+		{Pattern: " ", Strategy: WAIT_EXPRESSION},
+	}
+
+	want := []string{"waitSelector", "waitTimeout", "waitRules[1].pattern", "waitRules[1].expression"}
+	checkErrorFields(t, "validateWait", cfg.validateWait(), want)
+}
+
+// testwaitfor checks that the first matching rule wins case-insensitively, inherits the global idle
+// time when it sets none, and that the global settings apply to every other url
+func TestWaitFor(t *testing.T) {
+	cfg := NewConfig("https://example.com")
+	cfg.WaitStrategy = WAIT_NETWORK_IDLE
+	cfg.NetworkIdleTime = 750
+	cfg.WaitRules = []WaitRule{
+		{Pattern: "/Blog", Strategy: WAIT_SELECTOR, Selector: "article"},
+		{Pattern: "/blog/drafts", Strategy: WAIT_LOAD},
+		{Pattern: "/app", Strategy: WAIT_NETWORK_IDLE, IdleTime: 2000},
+	}
+
+	tests := []struct {
+		url  string
+		want WaitRule
+	}{
+		{"https://example.com/blog/drafts/1", WaitRule{Pattern: "/Blog", Strategy: WAIT_SELECTOR, Selector: "article", IdleTime: 750}},
+		{"https://example.com/APP/home", WaitRule{Pattern: "/app", Strategy: WAIT_NETWORK_IDLE, IdleTime: 2000}},
+		{"https://example.com/about", WaitRule{Strategy: WAIT_NETWORK_IDLE, IdleTime: 750}},
+	}
+
+	for _, test := range tests {
+		if got := cfg.WaitFor(test.url); got != test.want {
+			t.Errorf("WaitFor(%q) = %+v, want %+v", test.url, got, test.want)
+		}
+	}
+}
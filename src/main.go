@@ -2,31 +2,68 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net/url"
 	"os"
 	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 
 	"framely/src/config"
 	"framely/src/services"
-	"framely/src/utils"
 )
 
-// main is the entry point of the application, it clears the screen, prints the banner,
-// collects user input for configuration, initializes the app service, and runs it
+// main is the entry point of the application, it dispatches to the non-interactive crawl or diff command
+// when requested, otherwise it clears the screen, prints the banner, collects user input for
+// configuration, initializes the app service, and runs it
 func main() {
-	clearScreen()
-	printBanner()
+	if len(os.Args) > 1 && os.Args[1] == CRAWL_COMMAND {
+		cfg, err := parseCrawlFlags(os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			log.Fatalf("\033[31m> Configuration error: %v\033[0m", err)
+		}
+
+		if isTerminal(os.Stdout) {
+			printBanner()
+		}
+
+		runApp(cfg)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == DIFF_COMMAND {
+		opts, err := parseDiffFlags(os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			log.Fatalf("\033[31m> Configuration error: %v\033[0m", err)
+		}
+
+		runDiff(opts)
+		return
+	}
+
+	if isTerminal(os.Stdout) {
+		clearScreen()
+		printBanner()
+	}
 
 	cfg, err := collectUserInput()
 	if err != nil {
 		log.Fatalf("\033[31m> Configuration error: %v\033[0m", err)
 	}
 
+	runApp(cfg)
+}
+
+// runapp initializes the app service with the given config and runs it, exiting on failure
+func runApp(cfg *config.Config) {
 	appService := services.NewAppService(cfg)
 
 	if err := appService.Run(); err != nil {
@@ -34,6 +71,22 @@ func main() {
 	}
 }
 
+// rundiff compares the screenshots of two runs and writes the diff report, exiting on failure
+func runDiff(opts *diffOptions) {
+	if err := os.MkdirAll(opts.outputDir, 0755); err != nil {
+		log.Fatalf("\033[31m> Output directory creation failed: %v\033[0m", err)
+	}
+
+	diffService := services.NewDiffService(opts.threshold, opts.outputDir)
+	report, err := diffService.CompareDirectories(opts.baselineDir, opts.currentDir)
+	if err != nil {
+		log.Fatalf("\033[31m> Diff error: %v\033[0m", err)
+	}
+
+	log.Printf("\033[32m> Compared %d pages, %d changed above %.2f%%\033[0m", report.ComparedPages, report.ChangedPages, report.Threshold)
+	log.Printf("\033[36m> Diff report saved to %s\033[0m", opts.outputDir)
+}
+
 // clearscreen clears the terminal screen, it attempts to use 'clear' for unix-like systems,
 // and falls back to 'cls' for windows if the first command fails
 func clearScreen() {
@@ -108,29 +161,9 @@ func getTargetURL(reader *bufio.Reader) (string, error) {
 		return "", fmt.Errorf("failed to read URL: %w", err)
 	}
 
-	targetURL := strings.TrimSpace(input)
-	if targetURL == "" {
-		return "", fmt.Errorf("URL cannot be empty")
-	}
-
-	targetURL = utils.AddHTTPSIfMissing(targetURL)
-
-	u, err := url.Parse(targetURL)
+	targetURL, err := config.ValidateBaseURL(input)
 	if err != nil {
-		return "", fmt.Errorf("invalid URL format: %w", err)
-	}
-
-	host := u.Host
-	if host == "" {
-		return "", fmt.Errorf("URL must have a host")
-	}
-
-	matched, err := regexp.MatchString(config.DOMAIN_REGEX, host)
-	if err != nil {
-		return "", fmt.Errorf("regex error: %w", err)
-	}
-	if !matched {
-		return "", fmt.Errorf("invalid domain format")
+		return "", err
 	}
 
 	fmt.Printf("\033[32m> Target set: %s\n\n\033[0m", targetURL)
@@ -188,11 +221,8 @@ func configureDepth(reader *bufio.Reader, cfg *config.Config) error {
 		if err != nil {
 			return fmt.Errorf("invalid depth value: %w", err)
 		}
-		if depth < 1 {
-			return fmt.Errorf("depth must be at least 1")
-		}
-		if depth > 10 {
-			return fmt.Errorf("depth cannot exceed 10 for safety")
+		if err := config.ValidateDepth(depth); err != nil {
+			return err
 		}
 		cfg.MaxDepth = depth
 	}
@@ -237,11 +267,8 @@ func configureWorkerCount(reader *bufio.Reader, cfg *config.Config) error {
 		if err != nil {
 			return fmt.Errorf("invalid worker count: %w", err)
 		}
-		if workers < 1 {
-			return fmt.Errorf("worker count must be at least 1")
-		}
-		if workers > 10 {
-			return fmt.Errorf("worker count cannot exceed 10 for safety")
+		if err := config.ValidateWorkerCount(workers); err != nil {
+			return err
 		}
 		cfg.ParallelWorkers = workers
 	}
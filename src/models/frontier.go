@@ -0,0 +1,110 @@
+package models
+
+import (
+	"container/heap"
+	"time"
+)
+
+// frontierurl is a url waiting to be crawled, with the sitemap metadata that orders the queue
+type FrontierURL struct {
+	URL      string    `json:"url"`
+	Depth    int       `json:"depth"`
+	Priority float64   `json:"priority"`
+	LastMod  time.Time `json:"lastMod,omitzero"`
+}
+
+// frontieritem is a queued url with its insertion order, used to keep equal urls first in first out
+type frontierItem struct {
+	FrontierURL
+	key string
+	seq int
+}
+
+// urlfrontier is the crawl queue, a heap that hands out the url with the highest sitemap priority,
+// then the most recently modified one, then the one queued first
+type urlFrontier struct {
+	items     []frontierItem
+	positions map[string]int
+	seq       int
+}
+
+// len returns the number of queued urls
+func (f *urlFrontier) Len() int {
+	return len(f.items)
+}
+
+// less orders urls by priority, then lastmod, then insertion order
+func (f *urlFrontier) Less(i, j int) bool {
+	a, b := f.items[i], f.items[j]
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if !a.LastMod.Equal(b.LastMod) {
+		return a.LastMod.After(b.LastMod)
+	}
+	return a.seq < b.seq
+}
+
+// swap exchanges two queued urls
+func (f *urlFrontier) Swap(i, j int) {
+	f.items[i], f.items[j] = f.items[j], f.items[i]
+	if f.positions != nil {
+		f.positions[f.items[i].key] = i
+		f.positions[f.items[j].key] = j
+	}
+}
+
+// push appends an item for container/heap, use add instead
+func (f *urlFrontier) Push(x any) {
+	item := x.(frontierItem)
+	if f.positions != nil {
+		f.positions[item.key] = len(f.items)
+	}
+	f.items = append(f.items, item)
+}
+
+// pop removes the last item for container/heap, use next instead
+func (f *urlFrontier) Pop() any {
+	last := f.items[len(f.items)-1]
+	f.items = f.items[:len(f.items)-1]
+	if f.positions != nil {
+		delete(f.positions, last.key)
+	}
+	return last
+}
+
+// add queues a url under its normalized key
+func (f *urlFrontier) add(key string, url FrontierURL) {
+	if f.positions == nil {
+		f.positions = make(map[string]int)
+	}
+	f.seq++
+	heap.Push(f, frontierItem{FrontierURL: url, key: key, seq: f.seq})
+}
+
+// promote lowers the depth of a queued url when it is found again closer to the start page,
+// it reports whether the queued entry changed
+func (f *urlFrontier) promote(key string, depth int) bool {
+	i, ok := f.positions[key]
+	if !ok || f.items[i].Depth <= depth {
+		return false
+	}
+	f.items[i].Depth = depth
+	heap.Fix(f, i)
+	return true
+}
+
+// next removes and returns the url that should be crawled next
+func (f *urlFrontier) next() FrontierURL {
+	return heap.Pop(f).(frontierItem).FrontierURL
+}
+
+// ordered returns a copy of the queued urls in the order they would be handed out
+func (f *urlFrontier) ordered() []FrontierURL {
+	queued := urlFrontier{items: append([]frontierItem{}, f.items...)}
+	urls := make([]FrontierURL, 0, queued.Len())
+	for queued.Len() > 0 {
+		urls = append(urls, queued.next())
+	}
+	return urls
+}
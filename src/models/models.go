@@ -1,30 +1,167 @@
 package models
 
-import "time"
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"framely/src/config"
+	"framely/src/utils"
+)
 
 // screenshotresult represents the result of a screenshot capture operation
 type ScreenshotResult struct {
-	URL       string    `json:"url"`
-	Filename  string    `json:"filename"`
-	Success   bool      `json:"success"`
-	Error     string    `json:"error,omitempty"`
-	Timestamp time.Time `json:"timestamp"`
-	FileSize  int64     `json:"fileSize,omitempty"`
-	Duration  int64     `json:"duration,omitempty"`
+	URL           string            `json:"url"`
+	Title         string            `json:"title,omitempty"`
+	StatusCode    int               `json:"statusCode,omitempty"`
+	FinalURL      string            `json:"finalUrl,omitempty"`
+	Redirects     []Redirect        `json:"redirects,omitempty"`
+	ContentType   string            `json:"contentType,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Device        string            `json:"device,omitempty"`
+	Filename      string            `json:"filename"`
+	Format        string            `json:"format,omitempty"`
+	CaptureMode   string            `json:"captureMode,omitempty"`
+	CaptureTarget string            `json:"captureTarget,omitempty"`
+	Success       bool              `json:"success"`
+	Error         string            `json:"error,omitempty"`
+	ErrorClass    string            `json:"errorClass,omitempty"`
+	TimedOut      bool              `json:"timedOut,omitempty"`
+	Retries       int               `json:"retries,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+	FileSize      int64             `json:"fileSize,omitempty"`
+	Duration      int64             `json:"duration,omitempty"`
+	ETag          string            `json:"etag,omitempty"`
+	LastModified  string            `json:"lastModified,omitempty"`
+	History       []string          `json:"history,omitempty"`
+	Attempts      []Attempt         `json:"attempts,omitempty"`
+}
+
+// redirect is one hop of a redirect chain, the url that answered and the redirect status it answered with
+type Redirect struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// attempt records one capture attempt of a url and device, kept so retried pages show what happened before
+type Attempt struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Success    bool      `json:"success"`
+	Filename   string    `json:"filename,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorClass string    `json:"errorClass,omitempty"`
+	Duration   int64     `json:"duration,omitempty"`
+}
+
+// key identifies the page a result belongs to by its url normalized with the policy and its device profile
+func (sr ScreenshotResult) Key(policy config.URLPolicy) string {
+	return utils.NormalizeURL(sr.URL, policy) + "|" + sr.Device
+}
+
+// attempthistory returns the recorded attempts of the result, results written before attempts
+// were tracked count as a single attempt
+func (sr ScreenshotResult) AttemptHistory() []Attempt {
+	if len(sr.Attempts) > 0 {
+		return sr.Attempts
+	}
+	return []Attempt{{
+		Timestamp:  sr.Timestamp,
+		Success:    sr.Success,
+		Filename:   sr.Filename,
+		Error:      sr.Error,
+		ErrorClass: sr.ErrorClass,
+		Duration:   sr.Duration,
+	}}
+}
+
+// devicescreenshot holds the screenshot taken with one device profile, or the error that prevented it
+type DeviceScreenshot struct {
+	Device string
+	Data   []byte
+	Err    error
+}
+
+// pagecapture holds everything collected from a single page load, with one screenshot per device profile
+type PageCapture struct {
+	URL          string
+	FinalURL     string
+	Title        string
+	StatusCode   int
+	ContentType  string
+	Headers      map[string]string
+	Redirects    []Redirect
+	ETag         string
+	LastModified string
+	Screenshots  []DeviceScreenshot
+	Links        []string
+}
+
+// devicestats holds the result counts for one device profile
+type DeviceStats struct {
+	Total                 int `json:"total"`
+	SuccessfulScreenshots int `json:"successfulScreenshots"`
+	FailedScreenshots     int `json:"failedScreenshots"`
 }
 
 // report represents the overall report of a crawl session
 type Report struct {
-	BaseURL               string             `json:"baseUrl"`
-	TotalPages            int                `json:"totalPages"`
-	SuccessfulScreenshots int                `json:"successfulScreenshots"`
-	FailedScreenshots     int                `json:"failedScreenshots"`
-	Timestamp             time.Time          `json:"timestamp"`
-	LastUpdate            *time.Time         `json:"lastUpdate,omitempty"`
-	NewPagesInThisRun     int                `json:"newPagesInThisRun"`
-	TotalDuration         int64              `json:"totalDuration"`
-	AveragePageSize       int64              `json:"averagePageSize"`
-	Results               []ScreenshotResult `json:"results"`
+	BaseURL               string                 `json:"baseUrl"`
+	ImageFormat           string                 `json:"imageFormat,omitempty"`
+	TotalPages            int                    `json:"totalPages"`
+	TotalResults          int                    `json:"totalResults"`
+	SuccessfulScreenshots int                    `json:"successfulScreenshots"`
+	FailedScreenshots     int                    `json:"failedScreenshots"`
+	TimedOutScreenshots   int                    `json:"timedOutScreenshots,omitempty"`
+	Interrupted           bool                   `json:"interrupted,omitempty"`
+	StopReason            string                 `json:"stopReason,omitempty"`
+	UnvisitedURLs         []string               `json:"unvisitedUrls,omitempty"`
+	Exclusions            map[string]int         `json:"exclusions,omitempty"`
+	URLPolicy             *config.URLPolicy      `json:"urlPolicy,omitempty"`
+	Timestamp             time.Time              `json:"timestamp"`
+	LastUpdate            *time.Time             `json:"lastUpdate,omitempty"`
+	NewPagesInThisRun     int                    `json:"newPagesInThisRun"`
+	TotalDuration         int64                  `json:"totalDuration"`
+	AveragePageSize       int64                  `json:"averagePageSize"`
+	Devices               map[string]DeviceStats `json:"devices,omitempty"`
+	Results               []ScreenshotResult     `json:"results"`
+}
+
+// sessioncheckpoint is the crawl state saved to the output directory while crawling, so an interrupted
+// crawl can be resumed, queue holds every url still to be crawled including pages that were in progress,
+// excluded maps every excluded url to the rule that excluded it so the exclusion counts survive a resume
+type SessionCheckpoint struct {
+	BaseURL  string             `json:"baseUrl"`
+	SavedAt  time.Time          `json:"savedAt"`
+	Queue    []FrontierURL      `json:"queue"`
+	Visited  []string           `json:"visited"`
+	Excluded map[string]string  `json:"excluded,omitempty"`
+	Results  []ScreenshotResult `json:"results"`
+}
+
+// diffresult represents the comparison of one page between a baseline and a current run
+type DiffResult struct {
+	URL          string  `json:"url"`
+	Device       string  `json:"device,omitempty"`
+	BaselineFile string  `json:"baselineFile,omitempty"`
+	CurrentFile  string  `json:"currentFile,omitempty"`
+	DiffFile     string  `json:"diffFile,omitempty"`
+	DiffPercent  float64 `json:"diffPercent"`
+	Changed      bool    `json:"changed"`
+	Status       string  `json:"status"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// diffreport represents the overall visual comparison of two runs
+type DiffReport struct {
+	BaselineDir   string       `json:"baselineDir"`
+	CurrentDir    string       `json:"currentDir"`
+	Threshold     float64      `json:"threshold"`
+	Timestamp     time.Time    `json:"timestamp"`
+	ComparedPages int          `json:"comparedPages"`
+	ChangedPages  int          `json:"changedPages"`
+	MissingPages  int          `json:"missingPages"`
+	FailedPages   int          `json:"failedPages"`
+	Results       []DiffResult `json:"results"`
 }
 
 // sitemapurl represents a url entry in a sitemap
@@ -40,81 +177,370 @@ type URLSet struct {
 	URLs []SitemapURL `xml:"url"`
 }
 
-// crawlsession manages the state of a website crawl
+// sitemapref is an entry of a sitemap index pointing to another sitemap
+type SitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapindex represents a sitemap index listing other sitemaps
+type SitemapIndex struct {
+	Sitemaps []SitemapRef `xml:"sitemap"`
+}
+
+// crawlsession manages the state of a website crawl, it is safe for concurrent use,
+// every url is keyed by its form normalized with the url policy so queueing and claiming are deduplicated
 type CrawlSession struct {
+	mu             sync.Mutex
+	taskCond       *sync.Cond
+	inFlight       int
+	stopReason     string
+	stopped        chan struct{}
+	unvisitedURLs  []FrontierURL
+	activeURLs     map[string]FrontierURL
+	excludedURLs   map[string]string
 	baseURL        string
+	policy         config.URLPolicy
 	visitedURLs    map[string]bool
 	discoveredURLs map[string]bool
 	existingURLs   map[string]bool
-	urlQueue       []string
-	depthMap       map[string]int
+	queuedURLs     map[string]bool
+	frontier       urlFrontier
 	results        []ScreenshotResult
 	startTime      time.Time
 }
 
-// newcrawlsession creates a new crawlsession with initialized maps and start time
-func NewCrawlSession(baseURL string) *CrawlSession {
-	return &CrawlSession{
+// newcrawlsession creates a new crawlsession with initialized maps and start time, urls are
+// deduplicated by their form normalized with the given policy
+func NewCrawlSession(baseURL string, policy config.URLPolicy) *CrawlSession {
+	cs := &CrawlSession{
 		baseURL:        baseURL,
+		policy:         policy,
 		visitedURLs:    make(map[string]bool),
 		discoveredURLs: make(map[string]bool),
 		existingURLs:   make(map[string]bool),
-		urlQueue:       make([]string, 0),
-		depthMap:       make(map[string]int),
+		queuedURLs:     make(map[string]bool),
+		activeURLs:     make(map[string]FrontierURL),
+		excludedURLs:   make(map[string]string),
 		results:        make([]ScreenshotResult, 0),
+		stopped:        make(chan struct{}),
 		startTime:      time.Now(),
 	}
+	cs.taskCond = sync.NewCond(&cs.mu)
+	return cs
 }
 
-// addurl adds a url to the queue if not visited or existing, with the given depth
-func (cs *CrawlSession) AddURL(url string, depth int) {
-	if !cs.visitedURLs[url] && !cs.existingURLs[url] {
-		cs.urlQueue = append(cs.urlQueue, url)
-		cs.depthMap[url] = depth
+// key returns the normalized form a url is tracked by
+func (cs *CrawlSession) key(url string) string {
+	return utils.NormalizeURL(url, cs.policy)
+}
+
+// addurl adds a url to the queue with the given depth and the default sitemap priority if it is not
+// visited, existing, or already queued, it reports whether the url was added
+func (cs *CrawlSession) AddURL(url string, depth int) bool {
+	return cs.AddFrontierURL(FrontierURL{URL: url, Depth: depth, Priority: config.DEFAULT_SITEMAP_PRIORITY})
+}
+
+// addfrontierurl adds a url with its sitemap priority and lastmod date to the queue if it is not visited,
+// existing, or already queued, higher priority and more recently modified urls are handed out first,
+// a url that is still queued at a greater depth is moved to the lower depth instead,
+// it reports whether the url was added or moved
+func (cs *CrawlSession) AddFrontierURL(url FrontierURL) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := cs.key(url.URL)
+	if cs.visitedURLs[key] || cs.existingURLs[key] {
+		return false
+	}
+	if cs.queuedURLs[key] {
+		return cs.frontier.promote(key, url.Depth)
+	}
+
+	cs.frontier.add(key, url)
+	cs.queuedURLs[key] = true
+	cs.taskCond.Broadcast()
+	return true
+}
+
+// claimurl atomically marks a url as visited and reports whether the caller now owns it,
+// it returns false if the url was already visited or existing, so a url can only be claimed once
+func (cs *CrawlSession) ClaimURL(url string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := cs.key(url)
+	if cs.visitedURLs[key] || cs.existingURLs[key] {
+		return false
 	}
+
+	cs.visitedURLs[key] = true
+	return true
 }
 
 // markvisited marks a url as visited
 func (cs *CrawlSession) MarkVisited(url string) {
-	cs.visitedURLs[url] = true
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.visitedURLs[cs.key(url)] = true
 }
 
 // markexisting marks a url as existing
 func (cs *CrawlSession) MarkExisting(url string) {
-	cs.existingURLs[url] = true
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.existingURLs[cs.key(url)] = true
 }
 
 // addresult adds a screenshot result to the session
 func (cs *CrawlSession) AddResult(result ScreenshotResult) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
 	cs.results = append(cs.results, result)
 }
 
-// getnexturl returns the next url from the queue, its depth, and if there is one
+// getnexturl removes and returns the next url from the queue, its depth, and if there is one
 func (cs *CrawlSession) GetNextURL() (string, int, bool) {
-	if len(cs.urlQueue) == 0 {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.frontier.Len() == 0 || cs.stopReason != "" {
+		return "", 0, false
+	}
+
+	next := cs.frontier.next()
+	delete(cs.queuedURLs, cs.key(next.URL))
+	cs.activeURLs[cs.key(next.URL)] = next
+
+	return next.URL, next.Depth, true
+}
+
+// nexttask blocks until a url is available or the crawl is finished, a crawl is finished when the
+// queue is empty and no other task is in flight, or when it was stopped, every url returned must be
+// released with taskdone
+func (cs *CrawlSession) NextTask() (string, int, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for cs.frontier.Len() == 0 && cs.inFlight > 0 && cs.stopReason == "" {
+		cs.taskCond.Wait()
+	}
+
+	if cs.frontier.Len() == 0 || cs.stopReason != "" {
+		cs.taskCond.Broadcast()
 		return "", 0, false
 	}
 
-	url := cs.urlQueue[0]
-	cs.urlQueue = cs.urlQueue[1:]
-	depth := cs.depthMap[url]
+	next := cs.frontier.next()
+	delete(cs.queuedURLs, cs.key(next.URL))
+	cs.activeURLs[cs.key(next.URL)] = next
+	cs.inFlight++
+
+	return next.URL, next.Depth, true
+}
+
+// taskdone marks a task returned by nexttask as finished and wakes up waiting workers
+func (cs *CrawlSession) TaskDone() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.inFlight--
+	cs.taskCond.Broadcast()
+}
+
+// stop ends the crawl early for the given reason, urls still in the queue stay there but are no longer
+// handed out, and workers waiting in nexttask are released, the first reason given is kept
+func (cs *CrawlSession) Stop(reason string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.stopReason == "" {
+		cs.stopReason = reason
+		close(cs.stopped)
+	}
+	cs.taskCond.Broadcast()
+}
+
+// stopped returns a channel that is closed once the crawl is stopped
+func (cs *CrawlSession) Stopped() <-chan struct{} {
+	return cs.stopped
+}
+
+// stopreason returns why the crawl was stopped early, or an empty string if it was not
+func (cs *CrawlSession) StopReason() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 
-	return url, depth, true
+	return cs.stopReason
+}
+
+// markunvisited records a url that was taken from the queue but not captured because a limit was reached
+func (cs *CrawlSession) MarkUnvisited(url string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	entry, ok := cs.activeURLs[cs.key(url)]
+	if !ok {
+		entry = FrontierURL{URL: url, Priority: config.DEFAULT_SITEMAP_PRIORITY}
+	}
+	cs.unvisitedURLs = append(cs.unvisitedURLs, entry)
+}
+
+// finishurl marks a url taken from the queue as fully processed, urls that are not finished
+// are queued again when the session is restored from a checkpoint
+func (cs *CrawlSession) FinishURL(url string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	delete(cs.activeURLs, cs.key(url))
+}
+
+// unvisitedurls returns the urls left unvisited, those marked unvisited followed by everything
+// still in the queue in the order it would have been crawled
+func (cs *CrawlSession) UnvisitedURLs() []string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	urls := make([]string, 0, len(cs.unvisitedURLs)+cs.frontier.Len())
+	for _, entry := range cs.unvisitedURLs {
+		urls = append(urls, entry.URL)
+	}
+	for _, entry := range cs.frontier.ordered() {
+		urls = append(urls, entry.URL)
+	}
+	return urls
+}
+
+// checkpoint returns a snapshot of the session state, pages still in progress and urls left
+// unvisited are put back into the queue and are not counted as visited even if they were claimed
+func (cs *CrawlSession) Checkpoint() SessionCheckpoint {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	queue := make([]FrontierURL, 0, len(cs.activeURLs)+len(cs.unvisitedURLs)+cs.frontier.Len())
+	for _, entry := range cs.activeURLs {
+		queue = append(queue, entry)
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].URL < queue[j].URL })
+	queue = append(queue, cs.unvisitedURLs...)
+	queue = append(queue, cs.frontier.ordered()...)
+
+	requeued := make(map[string]bool, len(queue))
+	for _, entry := range queue {
+		requeued[cs.key(entry.URL)] = true
+	}
+
+	visited := make([]string, 0, len(cs.visitedURLs))
+	for key := range cs.visitedURLs {
+		if !requeued[key] {
+			visited = append(visited, key)
+		}
+	}
+	sort.Strings(visited)
+
+	excluded := make(map[string]string, len(cs.excludedURLs))
+	for key, rule := range cs.excludedURLs {
+		excluded[key] = rule
+	}
+
+	return SessionCheckpoint{
+		BaseURL:  cs.baseURL,
+		SavedAt:  time.Now(),
+		Queue:    queue,
+		Visited:  visited,
+		Excluded: excluded,
+		Results:  append([]ScreenshotResult{}, cs.results...),
+	}
+}
+
+// restore loads the queue, visited urls, exclusions and results of a checkpoint into the session,
+// queued urls keep their depth and sitemap metadata
+func (cs *CrawlSession) Restore(checkpoint SessionCheckpoint) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, url := range checkpoint.Visited {
+		cs.visitedURLs[cs.key(url)] = true
+	}
+
+	for url, rule := range checkpoint.Excluded {
+		key := cs.key(url)
+		if _, ok := cs.excludedURLs[key]; !ok {
+			cs.excludedURLs[key] = rule
+		}
+	}
+
+	for _, entry := range checkpoint.Queue {
+		key := cs.key(entry.URL)
+		if cs.visitedURLs[key] || cs.existingURLs[key] || cs.queuedURLs[key] {
+			continue
+		}
+		cs.frontier.add(key, entry)
+		cs.queuedURLs[key] = true
+	}
+
+	cs.results = append(cs.results, checkpoint.Results...)
+	cs.taskCond.Broadcast()
+}
+
+// markexcluded records the rule that kept a url from being crawled, a url is counted once for the first rule
+func (cs *CrawlSession) MarkExcluded(url, rule string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := cs.key(url)
+	if _, ok := cs.excludedURLs[key]; !ok {
+		cs.excludedURLs[key] = rule
+	}
+}
+
+// exclusioncounts returns how many distinct urls each rule excluded
+func (cs *CrawlSession) ExclusionCounts() map[string]int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, rule := range cs.excludedURLs {
+		counts[rule]++
+	}
+	return counts
+}
+
+// queuelength returns the number of urls waiting in the queue
+func (cs *CrawlSession) QueueLength() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.frontier.Len()
 }
 
 // isvisited checks if a url has been visited
 func (cs *CrawlSession) IsVisited(url string) bool {
-	return cs.visitedURLs[url]
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.visitedURLs[cs.key(url)]
 }
 
 // isexisting checks if a url is marked as existing
 func (cs *CrawlSession) IsExisting(url string) bool {
-	return cs.existingURLs[url]
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.existingURLs[cs.key(url)]
 }
 
-// getresults returns all screenshot results
+// getresults returns a copy of all screenshot results
 func (cs *CrawlSession) GetResults() []ScreenshotResult {
-	return cs.results
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	results := make([]ScreenshotResult, len(cs.results))
+	copy(results, cs.results)
+	return results
 }
 
 // getelapsedtime returns the time elapsed since session start
@@ -124,6 +550,9 @@ func (cs *CrawlSession) GetElapsedTime() time.Duration {
 
 // getstats returns total, success, and failed counts from results
 func (cs *CrawlSession) GetStats() (total int, success int, failed int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
 	total = len(cs.results)
 	for _, result := range cs.results {
 		if result.Success {
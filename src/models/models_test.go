@@ -0,0 +1,336 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"framely/src/config"
+)
+
+// testclaimurlisexclusive claims the same urls from many goroutines and checks each is won exactly once
+func TestClaimURLIsExclusive(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+
+	const goroutines = 50
+	const urls = 200
+
+	var claimed [urls]int32
+	var wg sync.WaitGroup
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < urls; i++ {
+				url := fmt.Sprintf("https://example.com/page-%d", i)
+				if i%2 == 0 {
+					url += "/"
+				}
+				if session.ClaimURL(url) {
+					atomic.AddInt32(&claimed[i], 1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for i, count := range claimed {
+		if count != 1 {
+			t.Fatalf("url %d claimed %d times, want 1", i, count)
+		}
+	}
+}
+
+// testclaimurlrejectsexisting checks that urls loaded from a previous report cannot be claimed
+func TestClaimURLRejectsExisting(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	session.MarkExisting("https://example.com/about")
+
+	if session.ClaimURL("https://example.com/about/") {
+		t.Fatal("existing url was claimed")
+	}
+	if session.AddURL("https://example.com/about", 1) {
+		t.Fatal("existing url was queued")
+	}
+}
+
+// testconcurrentfrontier hammers the queue with producers and consumers at once and checks
+// that every distinct url comes out exactly once and every result is recorded
+func TestConcurrentFrontier(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+
+	const producers = 20
+	const urls = 500
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < urls; i++ {
+				session.AddURL(fmt.Sprintf("https://example.com/item/%d", i), 1)
+			}
+		}()
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	done := make(chan struct{})
+
+	var consumers sync.WaitGroup
+	for c := 0; c < producers; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				url, _, ok := session.GetNextURL()
+				if !ok {
+					select {
+					case <-done:
+						if session.QueueLength() == 0 {
+							return
+						}
+					default:
+					}
+					continue
+				}
+				if !session.ClaimURL(url) {
+					continue
+				}
+				session.AddResult(ScreenshotResult{URL: url, Success: true})
+				mu.Lock()
+				seen[url]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	consumers.Wait()
+
+	if len(seen) != urls {
+		t.Fatalf("captured %d distinct urls, want %d", len(seen), urls)
+	}
+	for url, count := range seen {
+		if count != 1 {
+			t.Fatalf("url %s captured %d times, want 1", url, count)
+		}
+	}
+
+	total, success, failed := session.GetStats()
+	if total != urls || success != urls || failed != 0 {
+		t.Fatalf("stats = %d/%d/%d, want %d/%d/0", total, success, failed, urls, urls)
+	}
+	if len(session.GetResults()) != urls {
+		t.Fatalf("results length = %d, want %d", len(session.GetResults()), urls)
+	}
+}
+
+// testnexttaskwaitsforinflightwork runs a worker pool where each task discovers children, and checks
+// that workers keep draining the queue while others are still adding links instead of stopping early
+func TestNextTaskWaitsForInFlightWork(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	session.AddURL("https://example.com/", 0)
+
+	const workers = 8
+	const maxDepth = 3
+	const fanout = 4
+
+	var processed int32
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				url, depth, ok := session.NextTask()
+				if !ok {
+					return
+				}
+				if session.ClaimURL(url) {
+					atomic.AddInt32(&processed, 1)
+					if depth < maxDepth {
+						for i := 0; i < fanout; i++ {
+							session.AddURL(fmt.Sprintf("%s/%d", url, i), depth+1)
+						}
+					}
+				}
+				session.TaskDone()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	want := int32(1 + fanout + fanout*fanout + fanout*fanout*fanout)
+	if processed != want {
+		t.Fatalf("processed %d urls, want %d", processed, want)
+	}
+	if session.QueueLength() != 0 {
+		t.Fatalf("queue length = %d after workers exited, want 0", session.QueueLength())
+	}
+}
+
+// teststopreleaseswaitingworkers checks that stopping the session wakes a worker blocked in nexttask
+// and that queued urls are kept instead of being handed out
+func TestStopReleasesWaitingWorkers(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	session.AddURL("https://example.com/", 0)
+
+	if _, _, ok := session.NextTask(); !ok {
+		t.Fatal("no task for the start url")
+	}
+
+	released := make(chan bool)
+	go func() {
+		_, _, ok := session.NextTask()
+		released <- ok
+	}()
+
+	session.Stop("test")
+	if <-released {
+		t.Fatal("waiting worker got a task from an empty, stopped session")
+	}
+	session.TaskDone()
+
+	session.AddURL("https://example.com/late", 1)
+	if _, _, ok := session.NextTask(); ok {
+		t.Fatal("stopped session handed out a task")
+	}
+	if session.QueueLength() != 1 {
+		t.Fatalf("queue length = %d after stop, want 1", session.QueueLength())
+	}
+	if unvisited := session.UnvisitedURLs(); len(unvisited) != 1 || unvisited[0] != "https://example.com/late" {
+		t.Fatalf("unvisited urls = %v, want the late url", unvisited)
+	}
+	if session.StopReason() != "test" {
+		t.Fatalf("stop reason = %q, want test", session.StopReason())
+	}
+}
+
+// testaddurlpromotesqueueddepth checks that a queued url found again closer to the start page
+// is crawled at the lower depth, e.g. the start page after the sitemap already queued it
+func TestAddURLPromotesQueuedDepth(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	session.AddURL("https://example.com/blog", 1)
+	session.AddURL("https://example.com/", 1)
+
+	if !session.AddURL("https://example.com", 0) {
+		t.Fatal("queued url was not moved to depth 0")
+	}
+	if session.AddURL("https://example.com/", 2) {
+		t.Fatal("queued url was moved to a greater depth")
+	}
+	if session.QueueLength() != 2 {
+		t.Fatalf("queue length = %d, want 2", session.QueueLength())
+	}
+
+	depths := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		url, depth, ok := session.GetNextURL()
+		if !ok {
+			t.Fatal("queue ran out early")
+		}
+		depths[url] = depth
+	}
+	if depths["https://example.com/"] != 0 || depths["https://example.com/blog"] != 1 {
+		t.Fatalf("depths = %v, want the start page at 0 and the blog at 1", depths)
+	}
+}
+
+// testfrontierordersbypriority checks that urls come out by sitemap priority, then by lastmod,
+// then in the order they were queued
+func TestFrontierOrdersByPriority(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	recent := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	session.AddURL("https://example.com/first-link", 2)
+	session.AddFrontierURL(FrontierURL{URL: "https://example.com/old", Depth: 1, Priority: 0.8, LastMod: recent.AddDate(-1, 0, 0)})
+	session.AddURL("https://example.com/second-link", 2)
+	session.AddFrontierURL(FrontierURL{URL: "https://example.com/home", Depth: 1, Priority: 1})
+	session.AddFrontierURL(FrontierURL{URL: "https://example.com/new", Depth: 1, Priority: 0.8, LastMod: recent})
+	session.AddFrontierURL(FrontierURL{URL: "https://example.com/archive", Depth: 1, Priority: 0.1})
+
+	want := []string{"/home", "/new", "/old", "/first-link", "/second-link", "/archive"}
+	for _, path := range want {
+		url, _, ok := session.GetNextURL()
+		if !ok || url != "https://example.com"+path {
+			t.Fatalf("next url = %q, want %q", url, "https://example.com"+path)
+		}
+	}
+}
+
+// testcheckpointrestore checks that a restored session continues where the checkpoint left off,
+// pages that were still in progress are queued again while finished pages stay visited
+func TestCheckpointRestore(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	session.AddURL("https://example.com/done", 1)
+	session.AddURL("https://example.com/running", 1)
+	session.AddURL("https://example.com/queued", 2)
+
+	for _, want := range []string{"https://example.com/done", "https://example.com/running"} {
+		url, _, ok := session.NextTask()
+		if !ok || url != want {
+			t.Fatalf("next task = %q, want %q", url, want)
+		}
+		session.ClaimURL(url)
+	}
+	session.AddResult(ScreenshotResult{URL: "https://example.com/done", Success: true})
+	session.FinishURL("https://example.com/done")
+	session.TaskDone()
+	session.MarkExcluded("https://example.com/admin", "exclude:glob:/admin")
+
+	restored := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	restored.MarkExcluded("https://example.com/admin/", "exclude:glob:/admin")
+	restored.Restore(session.Checkpoint())
+
+	if counts := restored.ExclusionCounts(); counts["exclude:glob:/admin"] != 1 {
+		t.Fatalf("exclusion counts = %v after restore, want the excluded url counted once", counts)
+	}
+
+	if !restored.IsVisited("https://example.com/done") {
+		t.Fatal("finished page is not visited after restore")
+	}
+	if restored.IsVisited("https://example.com/running") {
+		t.Fatal("page in progress is visited after restore")
+	}
+	if len(restored.GetResults()) != 1 {
+		t.Fatalf("results length = %d after restore, want 1", len(restored.GetResults()))
+	}
+
+	want := map[string]int{"https://example.com/running": 1, "https://example.com/queued": 2}
+	for i := 0; i < 2; i++ {
+		url, depth, ok := restored.GetNextURL()
+		if !ok || want[url] != depth {
+			t.Fatalf("next url = %q at depth %d, want one of %v", url, depth, want)
+		}
+		delete(want, url)
+	}
+	if restored.QueueLength() != 0 {
+		t.Fatalf("queue length = %d, want 0", restored.QueueLength())
+	}
+}
+
+// testcrawlsessionusespolicy checks that the session deduplicates urls with the policy it was created with
+func TestCrawlSessionUsesPolicy(t *testing.T) {
+	session := NewCrawlSession("https://example.com", config.DefaultURLPolicy())
+	if !session.AddURL("https://example.com/products?page=2", 1) || !session.AddURL("https://example.com/products?page=3", 1) {
+		t.Fatal("pages with different query parameters were deduplicated under the default policy")
+	}
+
+	policy := config.DefaultURLPolicy()
+	policy.StripQuery = true
+	session = NewCrawlSession("https://example.com", policy)
+	if !session.AddURL("https://example.com/products?page=2", 1) {
+		t.Fatal("first url was not queued")
+	}
+	if session.AddURL("https://example.com/products?page=3", 1) {
+		t.Fatal("url that only differs by a stripped query was queued twice")
+	}
+}
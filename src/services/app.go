@@ -1,9 +1,14 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"framely/src/config"
@@ -11,6 +16,21 @@ import (
 	"framely/src/utils"
 )
 
+const (
+	STOP_REASON_COMPLETED     = "completed"
+	STOP_REASON_MAX_PAGES     = "max-pages"
+	STOP_REASON_CRAWL_TIMEOUT = "crawl-timeout"
+	STOP_REASON_INTERRUPTED   = "interrupted"
+	STOP_REASON_ROBOTS        = "robots-disallowed"
+	EXCLUDED_BY_ROBOTS        = "robots.txt"
+)
+
+// errcrawltimeout is the cause given to pages interrupted because the crawl timeout was reached
+var errCrawlTimeout = fmt.Errorf("crawl timeout reached: %w", context.DeadlineExceeded)
+
+// errinterrupted is the cause given to pages still running when the shutdown grace period ends
+var errInterrupted = errors.New("crawl interrupted")
+
 // appservice holds config and services for the main application logic
 type AppService struct {
 	config           *config.Config
@@ -18,16 +38,24 @@ type AppService struct {
 	discoveryService *DiscoveryService
 	reportService    *ReportService
 	session          *models.CrawlSession
+	previousResults  map[string][]models.ScreenshotResult
+	robots           *robotsRules
+	throttle         *crawlThrottle
+	budget           *pageBudget
+	filter           *utils.URLFilter
 }
 
-// newappservice creates a new appservice instance with initialized services
+// newappservice creates a new appservice instance with initialized services and applies the url normalization policy
 func NewAppService(cfg *config.Config) *AppService {
+
 	return &AppService{
 		config:           cfg,
 		browserService:   NewBrowserService(cfg),
-		discoveryService: NewDiscoveryService(cfg.BaseURL),
+		discoveryService: NewDiscoveryService(cfg.BaseURL, cfg.UserAgent, cfg.URLPolicy()),
 		reportService:    NewReportService(cfg),
-		session:          models.NewCrawlSession(cfg.BaseURL),
+		session:          models.NewCrawlSession(cfg.BaseURL, cfg.URLPolicy()),
+		previousResults:  make(map[string][]models.ScreenshotResult),
+		budget:           newPageBudget(cfg.MaxPages, cfg.MaxPrefixPages),
 	}
 }
 
@@ -37,6 +65,9 @@ func (as *AppService) Initialize() error {
 	log.Printf("\033[36m> Target: %s\033[0m", as.config.BaseURL)
 	log.Printf("\033[36m> Max Depth: %d\033[0m", as.config.MaxDepth)
 	log.Printf("\033[36m> Parallel Workers: %d\033[0m", as.config.ParallelWorkers)
+	if len(as.config.Devices) > 0 {
+		log.Printf("\033[36m> Devices: %d profiles per page\033[0m", len(as.config.Devices))
+	}
 
 	if err := as.reportService.EnsureOutputDirectory(); err != nil {
 		return fmt.Errorf("output directory creation failed: %w", err)
@@ -46,21 +77,209 @@ func (as *AppService) Initialize() error {
 		return fmt.Errorf("connection test failed: %w", err)
 	}
 
-	existingURLs, err := as.reportService.GetExistingURLs()
+	filter, err := utils.NewURLFilter(as.config.BaseURL, as.config.URLPolicy(), as.config.IncludeRules, as.config.ExcludeRules, as.config.SkipPatterns)
+	if err != nil {
+		return fmt.Errorf("invalid URL rules: %w", err)
+	}
+	as.filter = filter
+
+	if err := as.loadRobotsRules(); err != nil {
+		return err
+	}
+
+	previousResults, err := as.reportService.GetExistingResults()
 	if err != nil {
 		log.Printf("\033[31m> Could not load existing URLs: %s\033[0m", err.Error())
-		existingURLs = make(map[string]bool)
+		previousResults = make(map[string][]models.ScreenshotResult)
+	}
+	as.previousResults = previousResults
+
+	existing := 0
+	for _, results := range previousResults {
+		if !as.isRecaptureCandidate(results) {
+			as.session.MarkExisting(results[0].URL)
+			existing++
+		}
 	}
-	for url := range existingURLs {
-		as.session.MarkExisting(url)
+	log.Printf("\033[32m> Loaded %d existing URLs, %d eligible for recapture (%s)\033[0m", len(previousResults), len(previousResults)-existing, as.config.RecapturePolicy)
+
+	if as.config.Resume {
+		if err := as.resumeSession(); err != nil {
+			return fmt.Errorf("resume failed: %w", err)
+		}
 	}
-	log.Printf("\033[32m> Loaded %d existing URLs\033[0m", len(existingURLs))
 
 	return nil
 }
 
-// discoverurls discovers urls from sitemap and robots.txt if enabled, adds them to session
+// resumesession restores the queue, visited urls and results of an interrupted crawl from the checkpoint
+// in the output directory, restored pages count against the page limits, results already written to report.json
+// are not restored twice, without a checkpoint a new crawl starts
+func (as *AppService) resumeSession() error {
+	checkpoint, err := as.reportService.LoadCheckpoint()
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("\033[33m> No checkpoint found, starting a new crawl\033[0m")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if utils.NormalizeURL(checkpoint.BaseURL, as.config.URLPolicy()) != utils.NormalizeURL(as.config.BaseURL, as.config.URLPolicy()) {
+		return fmt.Errorf("checkpoint was saved for %s, not %s", checkpoint.BaseURL, as.config.BaseURL)
+	}
+
+	counted := make(map[string]bool)
+	restored := make([]models.ScreenshotResult, 0, len(checkpoint.Results))
+	for _, result := range checkpoint.Results {
+		if key := utils.NormalizeURL(result.URL, as.config.URLPolicy()); !counted[key] {
+			counted[key] = true
+			as.budget.take(result.URL)
+		}
+		if previous, ok := as.previousResult(result.URL, result.Device); ok && previous.Timestamp.Equal(result.Timestamp) {
+			continue
+		}
+		restored = append(restored, result)
+	}
+	checkpoint.Results = restored
+
+	as.session.Restore(*checkpoint)
+
+	log.Printf("\033[32m> Resumed checkpoint from %s: %d URLs queued, %d visited, %d results\033[0m", checkpoint.SavedAt.Format("2006-01-02 15:04:05"), len(checkpoint.Queue), len(checkpoint.Visited), len(checkpoint.Results))
+	return nil
+}
+
+// checkpointloop saves the session state at every interval until done is closed
+func (as *AppService) checkpointLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			as.saveCheckpoint()
+		}
+	}
+}
+
+// savecheckpoint writes the current session state to the output directory, a failed save is logged
+// and the crawl continues
+func (as *AppService) saveCheckpoint() {
+	if err := as.reportService.SaveCheckpoint(as.session.Checkpoint()); err != nil {
+		log.Printf("\033[31m> Checkpoint failed: %s\033[0m", err.Error())
+	}
+}
+
+// finishcheckpoint removes the checkpoint of a crawl that ran to completion, a crawl that stopped early
+// keeps a final checkpoint so it can be continued with --resume
+func (as *AppService) finishCheckpoint() {
+	if as.session.StopReason() != "" {
+		as.saveCheckpoint()
+		log.Printf("\033[36m> Checkpoint saved, run again with --resume to continue\033[0m")
+		return
+	}
+
+	if err := as.reportService.RemoveCheckpoint(); err != nil {
+		log.Printf("\033[31m> Could not remove checkpoint: %s\033[0m", err.Error())
+	}
+}
+
+// loadrobotsrules loads the robots.txt rules unless they are ignored, and throttles page loads
+// when robots.txt asks for a crawl delay, it fails when robots.txt was unreachable since that
+// disallows the whole site
+func (as *AppService) loadRobotsRules() error {
+	if as.config.IgnoreRobots {
+		log.Printf("\033[33m> Ignoring robots.txt rules\033[0m")
+		return nil
+	}
+
+	as.robots = as.discoveryService.loadRobots()
+	if as.robots.disallowAll {
+		return fmt.Errorf("robots.txt could not be fetched, so no page may be crawled, pass --ignore-robots for sites you own")
+	}
+
+	if delay := as.robots.crawlDelay(ROBOTS_AGENT_TOKEN); delay > 0 {
+		as.throttle = &crawlThrottle{interval: delay}
+		log.Printf("\033[36m> Robots.txt crawl delay: %s between page loads\033[0m", delay)
+	}
+
+	return nil
+}
+
+// robotsallowed reports whether robots.txt allows fetching the url, always true when robots.txt is ignored,
+// disallowed urls are counted as excluded by robots.txt
+func (as *AppService) robotsAllowed(url string) bool {
+	if as.robots == nil || as.robots.allowed(url, ROBOTS_AGENT_TOKEN) {
+		return true
+	}
+	as.session.MarkExcluded(url, EXCLUDED_BY_ROBOTS)
+	return false
+}
+
+// robotsblockedcrawl reports whether robots.txt disallows the start url and nothing was captured,
+// in which case the run ends with an empty report that should not count as a success
+func (as *AppService) robotsBlockedCrawl() bool {
+	return as.robots != nil && !as.robots.allowed(as.config.BaseURL, ROBOTS_AGENT_TOKEN) && len(as.session.GetResults()) == 0
+}
+
+// isrecapturecandidate applies the recapture policy to the previous results of a url at startup,
+// if-changed pages stay candidates until processurl checks them for changes
+func (as *AppService) isRecaptureCandidate(results []models.ScreenshotResult) bool {
+	switch as.config.RecapturePolicy {
+	case config.RECAPTURE_ALWAYS, config.RECAPTURE_IF_CHANGED:
+		return true
+	case config.RECAPTURE_OLDER_THAN:
+		cutoff := time.Now().Add(-as.config.RecaptureAge())
+		for _, result := range results {
+			if result.Timestamp.Before(cutoff) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// pagechanged reports whether a previously captured page changed since its oldest capture, a sitemap
+// lastmod date is trusted first, otherwise the stored etag and last-modified values are revalidated
+func (as *AppService) pageChanged(url string, results []models.ScreenshotResult) bool {
+	captured := results[0]
+	for _, result := range results {
+		if result.Timestamp.Before(captured.Timestamp) {
+			captured = result
+		}
+	}
+
+	if lastMod, ok := as.discoveryService.SitemapLastMod(url); ok {
+		return lastMod.After(captured.Timestamp)
+	}
+
+	changed, err := as.discoveryService.HasChanged(url, captured.ETag, captured.LastModified)
+	if err != nil {
+		log.Printf("\033[31m> Change check failed for %s, recapturing: %s\033[0m", url, err.Error())
+	}
+
+	return changed
+}
+
+// previousresult returns the previous successful result of a url for the given device, if any
+func (as *AppService) previousResult(url, device string) (models.ScreenshotResult, bool) {
+	for _, result := range as.previousResults[utils.NormalizeURL(url, as.config.URLPolicy())] {
+		if result.Device == device {
+			return result, true
+		}
+	}
+	return models.ScreenshotResult{}, false
+}
+
+// discoverurls seeds the queue with the start url at depth 0, then discovers urls from sitemap and robots.txt
+// if enabled and adds them to session, the seed comes first so a sitemap entry for the start page cannot queue it deeper
 func (as *AppService) DiscoverURLs() error {
+	as.session.AddURL(as.config.BaseURL, 0)
+
 	if !as.config.CheckSitemap && !as.config.CheckRobots {
 		log.Printf("\033[36m> URL discovery disabled\033[0m")
 		return nil
@@ -70,32 +289,88 @@ func (as *AppService) DiscoverURLs() error {
 
 	discoveredURLs := as.discoveryService.DiscoverURLs(as.config.CheckSitemap, as.config.CheckRobots)
 
+	queued := 0
 	for _, url := range discoveredURLs {
-		normalizedURL := utils.NormalizeURL(url)
-		if !as.session.IsVisited(normalizedURL) && !as.session.IsExisting(normalizedURL) {
-			as.session.AddURL(url, 1)
+		if as.robotsAllowed(url.URL) && as.exclusionRule(url.URL) == "" && as.session.AddFrontierURL(url) {
+			queued++
 		}
 	}
 
-	log.Printf("\033[32m> Discovery complete: %d URLs added to queue\033[0m", len(discoveredURLs))
+	log.Printf("\033[32m> Discovery complete: %d URLs found, %d added to queue\033[0m", len(discoveredURLs), queued)
 	return nil
 }
 
-// crawlwebsite starts the crawl process, chooses between sequential or parallel based on config
+// crawlwebsite starts the crawl process, chooses between sequential or parallel based on config,
+// when a crawl timeout is configured the session is stopped and running pages are interrupted once it expires,
+// an interrupt signal stops the session and interrupts running pages once the shutdown grace period ends,
+// signals are only caught while crawling so ctrl-c ends the other phases right away
 func (as *AppService) CrawlWebsite() error {
 	log.Printf("\033[36m> Starting website crawl...\033[0m")
 
-	as.session.AddURL(as.config.BaseURL, 0)
+	crawlCtx, interrupt := context.WithCancelCause(context.Background())
+	defer interrupt(nil)
+
+	ctx, cancel := context.WithCancel(crawlCtx)
+	if timeout := as.config.CrawlDuration(); timeout > 0 {
+		ctx, cancel = context.WithTimeoutCause(crawlCtx, timeout, errCrawlTimeout)
+	}
+	defer cancel()
+
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(context.Cause(ctx), errCrawlTimeout) {
+			log.Printf("\033[33m> Crawl timeout of %s reached, stopping with %d URLs still queued\033[0m", as.config.CrawlDuration(), as.session.QueueLength())
+			as.session.Stop(STOP_REASON_CRAWL_TIMEOUT)
+		}
+	})
+	defer stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go as.handleInterrupt(ctx, signals, interrupt)
+
+	if interval := as.config.CheckpointDuration(); interval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go as.checkpointLoop(interval, done)
+	}
 
 	if as.config.ParallelWorkers > 1 {
-		return as.runParallelCrawl()
+		return as.runParallelCrawl(ctx)
+	}
+
+	return as.runSequentialCrawl(ctx)
+}
+
+// handleinterrupt waits for an interrupt signal during the crawl, it stops handing out new urls, gives pages
+// in progress the shutdown grace period to finish, then interrupts them, a second signal skips the grace period
+func (as *AppService) handleInterrupt(ctx context.Context, signals <-chan os.Signal, interrupt context.CancelCauseFunc) {
+	select {
+	case <-ctx.Done():
+		return
+	case sig := <-signals:
+		log.Printf("\033[33m> Received %s, finishing pages in progress within %s, press ctrl-c again to stop now\033[0m", sig, as.config.ShutdownGraceDuration())
+	}
+
+	as.session.Stop(STOP_REASON_INTERRUPTED)
+
+	grace := time.NewTimer(as.config.ShutdownGraceDuration())
+	defer grace.Stop()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-signals:
+		log.Printf("\033[33m> Received a second signal, interrupting pages in progress\033[0m")
+	case <-grace.C:
+		log.Printf("\033[33m> Shutdown grace period over, interrupting pages in progress\033[0m")
 	}
 
-	return as.runSequentialCrawl()
+	interrupt(errInterrupted)
 }
 
 // runsequentialcrawl processes urls one by one, captures screenshots, extracts links
-func (as *AppService) runSequentialCrawl() error {
+func (as *AppService) runSequentialCrawl(ctx context.Context) error {
 	log.Printf("\033[36m> Running sequential crawl...\033[0m")
 
 	for {
@@ -104,120 +379,319 @@ func (as *AppService) runSequentialCrawl() error {
 			break
 		}
 
-		if depth > as.config.MaxDepth {
-			continue
+		if as.processURL(ctx, url, depth) {
+			as.waitRequestDelay(ctx)
 		}
+	}
 
-		normalizedURL := utils.NormalizeURL(url)
+	return nil
+}
 
-		if as.session.IsVisited(normalizedURL) {
-			continue
-		}
+// waitrequestdelay pauses for the request delay between sequential pages, it returns early when the
+// crawl is stopped or ctx is done so an interrupt does not wait for the delay to run out
+func (as *AppService) waitRequestDelay(ctx context.Context) {
+	timer := time.NewTimer(time.Duration(as.config.RequestDelay) * time.Second)
+	defer timer.Stop()
 
-		if as.session.IsExisting(normalizedURL) {
-			log.Printf("\033[36m> Skipping existing: %s\033[0m", url)
-			as.session.MarkVisited(normalizedURL)
-			continue
-		}
+	select {
+	case <-ctx.Done():
+	case <-as.session.Stopped():
+	case <-timer.C:
+	}
+}
 
-		if utils.ShouldSkipURL(url, as.config.SkipPatterns) {
-			log.Printf("\033[36m> Skipping pattern match: %s\033[0m", url)
-			as.session.MarkVisited(normalizedURL)
-			continue
+// runparallelcrawl starts a fixed pool of workers that pull urls from the session until the queue
+// is empty and no worker is still processing a page that could add new links
+func (as *AppService) runParallelCrawl(ctx context.Context) error {
+	log.Printf("\033[36m> Running parallel crawl with %d workers...\033[0m", as.config.ParallelWorkers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < as.config.ParallelWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			as.crawlWorker(ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// crawlworker takes tasks from the session and processes them until the crawl is finished
+func (as *AppService) crawlWorker(ctx context.Context) {
+	for {
+		url, depth, hasNext := as.session.NextTask()
+		if !hasNext {
+			return
 		}
 
-		as.session.MarkVisited(normalizedURL)
+		as.processURL(ctx, url, depth)
+		as.session.TaskDone()
+	}
+}
 
-		result := as.browserService.CaptureScreenshot(url)
-		as.session.AddResult(result)
+// processurl applies the depth, existing, and skip rules to a queued url, captures it if allowed,
+// and queues its links one level deeper, it reports whether a capture was attempted
+func (as *AppService) processURL(ctx context.Context, url string, depth int) bool {
+	defer as.session.FinishURL(url)
 
-		if result.Success && depth < as.config.MaxDepth {
-			links, err := as.browserService.ExtractLinks(url)
-			if err != nil {
-				log.Printf("\033[31m> Link extraction failed for %s: %s\033[0m", url, err.Error())
-			}
-			if err == nil {
-				as.addNewLinksToQueue(links, depth+1)
-			}
+	if ctx.Err() != nil {
+		as.session.MarkUnvisited(url)
+		return false
+	}
+
+	if depth > as.config.MaxDepth {
+		return false
+	}
+
+	if as.session.IsExisting(url) {
+		log.Printf("\033[36m> Skipping existing: %s\033[0m", url)
+		return false
+	}
+
+	if !as.session.ClaimURL(url) {
+		return false
+	}
+
+	if rule := as.exclusionRule(url); rule != "" {
+		log.Printf("\033[36m> Skipping excluded by %s: %s\033[0m", rule, url)
+		return false
+	}
+
+	if !as.robotsAllowed(url) {
+		log.Printf("\033[36m> Skipping robots.txt disallowed: %s\033[0m", url)
+		return false
+	}
+
+	if previous, ok := as.previousResults[utils.NormalizeURL(url, as.config.URLPolicy())]; ok && as.config.RecapturePolicy == config.RECAPTURE_IF_CHANGED {
+		if !as.pageChanged(url, previous) {
+			log.Printf("\033[36m> Skipping unchanged: %s\033[0m", url)
+			return false
 		}
+	}
 
-		time.Sleep(time.Duration(as.config.RequestDelay) * time.Second)
+	limit, exhausted := as.budget.take(url)
+	if exhausted && as.session.StopReason() == "" {
+		log.Printf("\033[33m> Page limit of %d reached, stopping with %d URLs still queued\033[0m", as.config.MaxPages, as.session.QueueLength())
+		as.session.Stop(STOP_REASON_MAX_PAGES)
+	}
+	switch limit {
+	case STOP_REASON_MAX_PAGES:
+		log.Printf("\033[36m> Skipping over page limit: %s\033[0m", url)
+		as.session.MarkUnvisited(url)
+		return false
+	case EXCLUDED_BY_PREFIX_LIMIT:
+		log.Printf("\033[36m> Skipping over limit of %d pages for %s: %s\033[0m", as.config.MaxPrefixPages, utils.PathPrefix(url), url)
+		as.session.MarkExcluded(url, EXCLUDED_BY_PREFIX_LIMIT)
+		return false
 	}
 
-	return nil
-}
+	results, links := as.capturePage(ctx, url)
 
-// runparallelcrawl processes urls in parallel using workers, captures screenshots, extracts links
-func (as *AppService) runParallelCrawl() error {
-	log.Printf("\033[36m> Running parallel crawl with %d workers...\033[0m", as.config.ParallelWorkers)
+	if as.crawlCutOff(ctx) && !allSucceeded(results) {
+		log.Printf("\033[33m> Crawl stopped before capture finished: %s\033[0m", url)
+		as.budget.refund(url)
+		as.session.MarkUnvisited(url)
+		return true
+	}
 
-	semaphore := make(chan struct{}, as.config.ParallelWorkers)
-	var wg sync.WaitGroup
-	resultsChan := make(chan models.ScreenshotResult, 100)
+	captured := false
+	for _, result := range results {
+		as.session.AddResult(result)
+		captured = captured || result.Success
+	}
 
-	go func() {
-		for result := range resultsChan {
-			as.session.AddResult(result)
+	if captured && depth < as.config.MaxDepth {
+		as.addNewLinksToQueue(links, depth+1)
+	}
+
+	return true
+}
+
+// crawlcutoff reports whether the crawl as a whole was stopped while pages were still running, because of an
+// interrupt or the crawl timeout, pages cut off this way are left unvisited instead of being recorded as failed
+func (as *AppService) crawlCutOff(ctx context.Context) bool {
+	return as.session.StopReason() == STOP_REASON_INTERRUPTED || errors.Is(context.Cause(ctx), errCrawlTimeout)
+}
+
+// allsucceeded reports whether every result of a page capture was successful
+func allSucceeded(results []models.ScreenshotResult) bool {
+	for _, result := range results {
+		if !result.Success {
+			return false
 		}
-	}()
+	}
+	return true
+}
 
-	for {
-		url, depth, hasNext := as.session.GetNextURL()
-		if !hasNext {
-			break
+// capturepage loads the page once through the browser service, saves one screenshot per device profile,
+// and returns a result for every profile together with the links found on the page
+func (as *AppService) capturePage(ctx context.Context, url string) ([]models.ScreenshotResult, []string) {
+	startTime := time.Now()
+
+	log.Printf("\033[36m> Capturing screenshot: %s\033[0m", url)
+
+	capture, retries, err := as.processPageWithRetry(ctx, url)
+	duration := time.Since(startTime).Milliseconds()
+
+	if err != nil {
+		log.Printf("\033[31m> Screenshot failed for %s: %s\033[0m", url, err.Error())
+		errorClass := classifyError(err, capture.StatusCode)
+		results := make([]models.ScreenshotResult, 0)
+		for _, profile := range as.config.Profiles() {
+			result := as.newResult(capture, profile.Name, startTime, duration)
+			result.Error = err.Error()
+			result.ErrorClass = errorClass
+			result.TimedOut = errors.Is(err, context.DeadlineExceeded)
+			result.Retries = retries
+			results = append(results, result)
 		}
+		return results, nil
+	}
 
-		if depth > as.config.MaxDepth {
-			continue
+	results := make([]models.ScreenshotResult, 0, len(capture.Screenshots))
+	for _, screenshot := range capture.Screenshots {
+		result := as.saveScreenshot(capture, screenshot, startTime, duration)
+		result.Retries = retries
+		results = append(results, result)
+	}
+
+	return results, capture.Links
+}
+
+// processpagewithretry loads and captures a page, retrying with backoff while the page or one of its
+// device screenshots fails with a transient error, it returns the last attempt, how many retries it took
+// and the error of the last attempt
+func (as *AppService) processPageWithRetry(ctx context.Context, url string) (*models.PageCapture, int, error) {
+	for retry := 0; ; retry++ {
+		if as.throttle != nil {
+			if err := as.throttle.wait(ctx); err != nil {
+				return &models.PageCapture{URL: url}, retry, err
+			}
 		}
 
-		normalizedURL := utils.NormalizeURL(url)
+		capture, err := as.browserService.ProcessPage(ctx, url)
 
-		if as.session.IsVisited(normalizedURL) || as.session.IsExisting(normalizedURL) {
-			continue
+		errorClass := classifyError(err, capture.StatusCode)
+		if err == nil {
+			for _, screenshot := range capture.Screenshots {
+				if class := classifyError(screenshot.Err, capture.StatusCode); isTransientError(class) {
+					errorClass = class
+					break
+				}
+			}
 		}
 
-		if utils.ShouldSkipURL(url, as.config.SkipPatterns) {
-			continue
+		if !isTransientError(errorClass) || retry+1 >= as.config.RetryAttempts || ctx.Err() != nil {
+			return capture, retry, err
 		}
 
-		as.session.MarkVisited(normalizedURL)
+		delay := retryDelay(retry+1, as.config.RetryBackoffBase(), as.config.RetryBackoffMax())
+		log.Printf("\033[33m> Retrying %s in %s after %s error (attempt %d/%d)\033[0m", url, delay.Round(time.Millisecond), errorClass, retry+2, as.config.RetryAttempts)
 
-		wg.Add(1)
-		go func(pageURL string, pageDepth int) {
-			defer wg.Done()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return capture, retry, err
+		}
+	}
+}
 
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+// newresult builds the result of one device capture of a page with everything known about the page load,
+// the caller fills in the outcome
+func (as *AppService) newResult(capture *models.PageCapture, device string, startTime time.Time, duration int64) models.ScreenshotResult {
+	rule := as.config.CaptureFor(capture.URL)
+
+	return models.ScreenshotResult{
+		URL:           capture.URL,
+		Title:         capture.Title,
+		StatusCode:    capture.StatusCode,
+		FinalURL:      capture.FinalURL,
+		Redirects:     capture.Redirects,
+		ContentType:   capture.ContentType,
+		Headers:       capture.Headers,
+		Device:        device,
+		Filename:      utils.GenerateFilename(capture.URL, device, as.config.ImageExtension(), as.config.URLPolicy()),
+		Format:        as.config.ImageFormat,
+		CaptureMode:   rule.Mode,
+		CaptureTarget: rule.Target(),
+		Timestamp:     startTime,
+		Duration:      duration,
+		ETag:          capture.ETag,
+		LastModified:  capture.LastModified,
+	}
+}
 
-			result := as.browserService.CaptureScreenshot(pageURL)
-			resultsChan <- result
+// savescreenshot writes one device screenshot of a captured page and builds its result, the image is written
+// to a temporary file first so a failed write leaves the previous screenshot and its history untouched
+func (as *AppService) saveScreenshot(capture *models.PageCapture, screenshot models.DeviceScreenshot, startTime time.Time, duration int64) models.ScreenshotResult {
+	result := as.newResult(capture, screenshot.Device, startTime, duration)
+	filename := result.Filename
+
+	if screenshot.Err != nil {
+		result.Success = false
+		result.Error = screenshot.Err.Error()
+		result.ErrorClass = classifyError(screenshot.Err, capture.StatusCode)
+		result.TimedOut = errors.Is(screenshot.Err, context.DeadlineExceeded)
+		log.Printf("\033[31m> Screenshot failed for %s (%s): %s\033[0m", capture.URL, screenshot.Device, screenshot.Err.Error())
+		return result
+	}
 
-			if result.Success && pageDepth < as.config.MaxDepth {
-				links, err := as.browserService.ExtractLinks(pageURL)
-				if err == nil {
-					as.addNewLinksToQueue(links, pageDepth+1)
-				}
-			}
-		}(url, depth)
+	tempPath, fileSize, err := as.reportService.WriteTempScreenshot(filename, screenshot.Data)
+	if err != nil {
+		return as.writeFailed(result, err)
 	}
 
-	wg.Wait()
-	close(resultsChan)
+	if previous, ok := as.previousResult(capture.URL, screenshot.Device); ok {
+		result.History = previous.History
+		archived, err := as.reportService.ArchiveScreenshot(previous.Filename, previous.Timestamp)
+		if err != nil {
+			log.Printf("\033[31m> Could not archive previous screenshot %s: %s\033[0m", previous.Filename, err.Error())
+		}
+		if err == nil {
+			result.History = append(append([]string{}, previous.History...), archived)
+		}
+	}
 
-	return nil
+	if err := as.reportService.CommitScreenshot(tempPath, filename); err != nil {
+		return as.writeFailed(result, err)
+	}
+
+	result.FileSize = fileSize
+	result.Success = true
+	log.Printf("\033[32m> Screenshot saved: %s (%.2fKB)\033[0m", filename, float64(result.FileSize)/1024)
+
+	return result
+}
+
+// exclusionrule returns the skip pattern or include or exclude rule that keeps the url from being crawled,
+// or an empty string, and records the rule for the report
+func (as *AppService) exclusionRule(url string) string {
+	rule := as.filter.ExcludedBy(url)
+	if rule != "" {
+		as.session.MarkExcluded(url, rule)
+	}
+	return rule
+}
+
+// writefailed marks a result as failed because its screenshot could not be written
+func (as *AppService) writeFailed(result models.ScreenshotResult, err error) models.ScreenshotResult {
+	result.Success = false
+	result.Error = fmt.Sprintf("File write error: %s", err.Error())
+	result.ErrorClass = ERROR_CLASS_WRITE
+	log.Printf("\033[31m> File write failed for %s: %s\033[0m", result.Filename, err.Error())
+	return result
 }
 
 // addnewlinkstoqueue adds valid, unvisited links to the crawl queue at the given depth
 func (as *AppService) addNewLinksToQueue(links []string, depth int) {
 	for _, link := range links {
 		fixedLink := utils.FixRelativeURL(link, as.config.BaseURL)
-		if utils.IsValidURL(fixedLink, as.config.BaseURL) {
-			normalizedLink := utils.NormalizeURL(fixedLink)
-			if !as.session.IsVisited(normalizedLink) && !as.session.IsExisting(normalizedLink) {
-				if !utils.ShouldSkipURL(fixedLink, as.config.SkipPatterns) {
-					as.session.AddURL(fixedLink, depth)
-				}
+		if utils.IsValidURL(fixedLink, as.config.BaseURL, as.config.URLPolicy()) {
+			if as.exclusionRule(fixedLink) == "" && as.robotsAllowed(fixedLink) {
+				as.session.AddFrontierURL(as.discoveryService.FrontierURL(fixedLink, depth))
 			}
 		}
 	}
@@ -237,6 +711,8 @@ func (as *AppService) GenerateReport() error {
 		return fmt.Errorf("report generation failed: %w", err)
 	}
 
+	as.finishCheckpoint()
+
 	total, success, failed := as.session.GetStats()
 	elapsed := as.session.GetElapsedTime()
 
@@ -246,10 +722,27 @@ func (as *AppService) GenerateReport() error {
 	log.Printf("\033[32m> Success: %d pages\033[0m", success)
 	log.Printf("\033[31m> Failed: %d pages\033[0m", failed)
 	log.Printf("\033[36m> Duration: %.2f seconds\033[0m", elapsed.Seconds())
+	if reason := as.session.StopReason(); reason != "" {
+		log.Printf("\033[33m> Stopped early (%s), %d URLs left unvisited\033[0m", reason, len(as.session.UnvisitedURLs()))
+	}
 
 	return nil
 }
 
+// comparewithbaseline diffs the screenshots of this output directory against the configured baseline run
+func (as *AppService) CompareWithBaseline() error {
+	log.Printf("\033[36m> Comparing with baseline: %s\033[0m", as.config.DiffBaseline)
+
+	diffService := NewDiffService(as.config.DiffThreshold, as.config.OutputDir)
+	report, err := diffService.CompareDirectories(as.config.DiffBaseline, as.config.OutputDir)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("\033[32m> Compared %d pages, %d changed above %.2f%%\033[0m", report.ComparedPages, report.ChangedPages, report.Threshold)
+	return nil
+}
+
 // cleanup closes browser service and logs completion
 func (as *AppService) Cleanup() {
 	log.Printf("\033[36m> Cleaning up resources...\033[0m")
@@ -261,7 +754,8 @@ func (as *AppService) Cleanup() {
 	log.Printf("\033[32m> Cleanup complete\033[0m")
 }
 
-// run orchestrates the entire application flow, initialize, discover, crawl, report, cleanup
+// run orchestrates the entire application flow, initialize, discover, crawl, report, cleanup,
+// an interrupted crawl still writes a partial report and then returns an error
 func (as *AppService) Run() error {
 	defer as.Cleanup()
 
@@ -277,10 +771,29 @@ func (as *AppService) Run() error {
 		return fmt.Errorf("website crawl failed: %w", err)
 	}
 
+	if as.robotsBlockedCrawl() {
+		log.Printf("\033[31m> Robots.txt disallows %s for %s, no page was captured\033[0m", as.config.BaseURL, ROBOTS_AGENT_TOKEN)
+		as.session.Stop(STOP_REASON_ROBOTS)
+	}
+
 	if err := as.GenerateReport(); err != nil {
 		return fmt.Errorf("report generation failed: %w", err)
 	}
 
+	if as.session.StopReason() == STOP_REASON_INTERRUPTED {
+		return fmt.Errorf("%w, partial report saved to %s", errInterrupted, as.config.OutputDir)
+	}
+
+	if as.session.StopReason() == STOP_REASON_ROBOTS {
+		return fmt.Errorf("robots.txt disallows crawling %s, pass --ignore-robots for sites you own", as.config.BaseURL)
+	}
+
+	if as.config.DiffBaseline != "" {
+		if err := as.CompareWithBaseline(); err != nil {
+			return fmt.Errorf("baseline comparison failed: %w", err)
+		}
+	}
+
 	log.Printf("\033[32m> Framely completed successfully!\033[0m")
 	return nil
 }
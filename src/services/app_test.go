@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"framely/src/config"
+	"framely/src/models"
+)
+
+// newtestappservice returns an app service with only a config and a session, enough for the crawl
+// control logic that does not need a browser
+func newTestAppService(cfg *config.Config) *AppService {
+	return &AppService{
+		config:  cfg,
+		session: models.NewCrawlSession(cfg.BaseURL, cfg.URLPolicy()),
+	}
+}
+
+// runinterrupthandler starts handleinterrupt and returns a channel that receives the cause it
+// interrupted with, or nil when it returned without interrupting
+func runInterruptHandler(ctx context.Context, as *AppService, signals <-chan os.Signal) <-chan error {
+	causes := make(chan error, 1)
+	interrupted := make(chan error, 1)
+	go func() {
+		as.handleInterrupt(ctx, signals, func(cause error) { interrupted <- cause })
+		select {
+		case cause := <-interrupted:
+			causes <- cause
+		default:
+			causes <- nil
+		}
+	}()
+	return causes
+}
+
+// testhandleinterrupt checks that the first signal stops the session and that running pages are
+// interrupted after the grace period, or right away on a second signal
+func TestHandleInterrupt(t *testing.T) {
+	tests := []struct {
+		name          string
+		grace         string
+		secondSignal  bool
+		wantInterrupt bool
+	}{
+		{"grace period ends", "50ms", false, true},
+		{"second signal", "1h", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.NewConfig("https://example.com")
+			cfg.ShutdownGrace = test.grace
+			as := newTestAppService(cfg)
+
+			signals := make(chan os.Signal, 1)
+			causes := runInterruptHandler(context.Background(), as, signals)
+
+			signals <- os.Interrupt
+			select {
+			case <-as.session.Stopped():
+			case <-time.After(time.Second):
+				t.Fatal("first signal did not stop the session")
+			}
+			if reason := as.session.StopReason(); reason != STOP_REASON_INTERRUPTED {
+				t.Fatalf("stop reason = %q, want %q", reason, STOP_REASON_INTERRUPTED)
+			}
+
+			if test.secondSignal {
+				signals <- syscall.SIGTERM
+			}
+
+			select {
+			case cause := <-causes:
+				if !errors.Is(cause, errInterrupted) {
+					t.Fatalf("interrupt cause = %v, want %v", cause, errInterrupted)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("pages in progress were not interrupted")
+			}
+		})
+	}
+}
+
+// testhandleinterruptendswithcrawl checks that the handler returns without stopping anything when the
+// crawl finishes, before or after the first signal
+func TestHandleInterruptEndsWithCrawl(t *testing.T) {
+	cfg := config.NewConfig("https://example.com")
+	cfg.ShutdownGrace = "1h"
+
+	as := newTestAppService(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	causes := runInterruptHandler(ctx, as, make(chan os.Signal))
+	cancel()
+
+	if cause := <-causes; cause != nil {
+		t.Fatalf("finished crawl was interrupted with %v", cause)
+	}
+	if reason := as.session.StopReason(); reason != "" {
+		t.Fatalf("finished crawl was stopped with %q", reason)
+	}
+
+	as = newTestAppService(cfg)
+	ctx, cancel = context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	causes = runInterruptHandler(ctx, as, signals)
+	signals <- os.Interrupt
+	<-as.session.Stopped()
+	cancel()
+
+	if cause := <-causes; cause != nil {
+		t.Fatalf("crawl that finished within the grace period was interrupted with %v", cause)
+	}
+}
+
+// testwaitrequestdelaystopsearly checks that the delay between sequential pages ends as soon as the
+// session is stopped or ctx is done
+func TestWaitRequestDelayStopsEarly(t *testing.T) {
+	cfg := config.NewConfig("https://example.com")
+	cfg.RequestDelay = 60
+
+	as := newTestAppService(cfg)
+	as.session.Stop(STOP_REASON_INTERRUPTED)
+	start := time.Now()
+	as.waitRequestDelay(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("stopped session waited %s", elapsed)
+	}
+
+	as = newTestAppService(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	as.waitRequestDelay(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("cancelled crawl waited %s", elapsed)
+	}
+}
+
+// testrobotsblockedcrawl checks that urls robots.txt disallows are counted as excluded and that a
+// disallowed start url only blocks the run when nothing was captured
+func TestRobotsBlockedCrawl(t *testing.T) {
+	cfg := config.NewConfig("https://example.com/")
+	as := newTestAppService(cfg)
+	as.robots = parseRobots("User-agent: framely\nDisallow: /\n\nUser-agent: *\nAllow: /\n")
+
+	if as.robotsAllowed("https://example.com/about") {
+		t.Fatal("url disallowed for framely was allowed")
+	}
+	if count := as.session.ExclusionCounts()[EXCLUDED_BY_ROBOTS]; count != 1 {
+		t.Fatalf("robots.txt exclusions = %d, want 1", count)
+	}
+	if !as.robotsBlockedCrawl() {
+		t.Fatal("disallowed start url with no results did not block the crawl")
+	}
+
+	as.session.AddResult(models.ScreenshotResult{URL: "https://example.com/", Device: "desktop"})
+	if as.robotsBlockedCrawl() {
+		t.Fatal("crawl with results counted as blocked")
+	}
+
+	as.robots = nil
+	if !as.robotsAllowed("https://example.com/about") || newTestAppService(cfg).robotsBlockedCrawl() {
+		t.Fatal("ignored robots.txt still blocked urls")
+	}
+}
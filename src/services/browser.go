@@ -2,14 +2,19 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/inspector"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/chromedp"
 
 	"framely/src/config"
@@ -17,127 +22,549 @@ import (
 	"framely/src/utils"
 )
 
-// browserservice holds config, context, and cancel for browser operations
+// browserservice holds config, the allocator and browser contexts, and a pool of tabs so that
+// parallel workers never navigate the same target
 type BrowserService struct {
-	config *config.Config
-	ctx    context.Context
-	cancel context.CancelFunc
+	config      *config.Config
+	allocCtx    context.Context
+	allocCancel context.CancelFunc
+	ctx         context.Context
+	cancel      context.CancelFunc
+	tabs        *tabPool
+	startOnce   sync.Once
+	startErr    error
 }
 
-// newbrowserservice creates a new browserservice instance with chromedp setup
+// newbrowserservice creates a new browserservice instance with chromedp setup and one tab slot per worker,
+// rendering options from the config are turned into allocator options
 func NewBrowserService(cfg *config.Config) *BrowserService {
-	opts := make([]chromedp.ExecAllocatorOption, 0, len(chromedp.DefaultExecAllocatorOptions)+len(config.CHROME_FLAGS)+1)
+	opts := make([]chromedp.ExecAllocatorOption, 0, len(chromedp.DefaultExecAllocatorOptions)+len(config.CHROME_FLAGS)+len(cfg.ChromeFlags)+4)
 	opts = append(opts, chromedp.DefaultExecAllocatorOptions[:]...)
 
 	for _, flag := range config.CHROME_FLAGS {
-		opts = append(opts, chromedp.Flag(strings.TrimPrefix(flag, "--"), true))
+		opts = append(opts, chromeFlagOption(flag))
+	}
+
+	if !cfg.EnableImages {
+		opts = append(opts, chromedp.Flag("blink-settings", "imagesEnabled=false"))
+	}
+
+	opts = append(opts, chromedp.Flag("disable-extensions", !cfg.EnableExtensions))
+
+	for _, flag := range cfg.ChromeFlags {
+		opts = append(opts, chromeFlagOption(flag))
+	}
+
+	if cfg.ChromePath != "" {
+		opts = append(opts, chromedp.ExecPath(cfg.ChromePath))
 	}
 
 	opts = append(opts, chromedp.UserAgent(cfg.UserAgent))
 
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	ctx, _ := chromedp.NewContext(allocCtx)
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	ctx, cancel := chromedp.NewContext(allocCtx)
+
+	bs := &BrowserService{
+		config:      cfg,
+		allocCtx:    allocCtx,
+		allocCancel: allocCancel,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	bs.tabs = newTabPool(cfg.ParallelWorkers, cfg.TabRecycleAfter, bs.newTab)
+
+	return bs
+}
 
-	return &BrowserService{
-		config: cfg,
-		ctx:    ctx,
-		cancel: cancel,
+// chromeflagoption converts a command line style flag, e.g. --lang=de or --force-dark-mode,
+// into an allocator option
+func chromeFlagOption(flag string) chromedp.ExecAllocatorOption {
+	name, value, hasValue := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+	if hasValue {
+		return chromedp.Flag(name, value)
 	}
+	return chromedp.Flag(name, true)
 }
 
-// close cancels the browser context
+// close cancels the browser context, which closes every tab, and shuts down the allocator
 func (bs *BrowserService) Close() {
 	if bs.cancel != nil {
 		bs.cancel()
 	}
+	if bs.allocCancel != nil {
+		bs.allocCancel()
+	}
 }
 
-// capturescreenshot navigates to the url, takes a full screenshot, saves it to file, returns result
-func (bs *BrowserService) CaptureScreenshot(url string) models.ScreenshotResult {
-	startTime := time.Now()
-	filename := utils.GenerateFilename(url)
-	filepath := filepath.Join(bs.config.OutputDir, filename)
+// start launches the browser once, it must run before any context with a deadline is derived from
+// the browser context, since chromedp ties the browser process to the context of its first run
+func (bs *BrowserService) start() error {
+	bs.startOnce.Do(func() {
+		bs.startErr = chromedp.Run(bs.ctx)
+	})
+	if bs.startErr != nil {
+		return fmt.Errorf("browser start failed: %w", bs.startErr)
+	}
+	return nil
+}
+
+// newtab opens a new target in the shared browser and watches it for crashes
+func (bs *BrowserService) newTab() (*browserTab, error) {
+	if err := bs.start(); err != nil {
+		return nil, err
+	}
 
-	log.Printf("\033[36m> Capturing screenshot: %s\033[0m", url)
+	tabCtx, tabCancel := chromedp.NewContext(bs.ctx)
+	tab := &browserTab{ctx: tabCtx, cancel: tabCancel}
 
-	result := models.ScreenshotResult{
-		URL:       url,
-		Filename:  filename,
-		Timestamp: startTime,
+	chromedp.ListenTarget(tabCtx, func(ev any) {
+		switch ev.(type) {
+		case *inspector.EventTargetCrashed, *inspector.EventDetached:
+			tab.crashed.Store(true)
+		}
+	})
+
+	if err := chromedp.Run(tabCtx); err != nil {
+		tabCancel()
+		return nil, fmt.Errorf("tab creation failed: %w", err)
+	}
+
+	if !bs.config.EnableJavaScript {
+		if err := chromedp.Run(tabCtx, emulation.SetScriptExecutionDisabled(true)); err != nil {
+			tabCancel()
+			return nil, fmt.Errorf("disabling JavaScript failed: %w", err)
+		}
 	}
 
+	return tab, nil
+}
+
+// linkextractionscript collects the absolute href of every anchor on the page
+const linkExtractionScript = `
+	Array.from(document.querySelectorAll('a[href]')).map(link => {
+		try {
+			return new URL(link.href, window.location.href).href;
+		} catch (e) {
+			return null;
+		}
+	}).filter(href => href !== null);
+`
+
+// processpage loads the url once and collects the links, title, final url and status from that page load,
+// then captures one screenshot per device profile, the first profile uses the initial load and every
+// other profile reloads the page after switching emulation, the returned capture holds whatever was
+// collected even on error, loading and every capture run under their own timeout and stop early
+// when ctx is done
+func (bs *BrowserService) ProcessPage(ctx context.Context, url string) (*models.PageCapture, error) {
+	capture := &models.PageCapture{URL: url}
+	profiles := bs.config.Profiles()
+	rule := bs.config.CaptureFor(url)
+	waitRule := bs.config.WaitFor(url)
+
+	tab, err := bs.tabs.acquire()
+	if err != nil {
+		return capture, err
+	}
+	defer bs.tabs.release(tab)
+
+	loadCtx, cancelLoad := bs.phaseContext(ctx, tab, bs.config.PageLoadDuration())
+	defer cancelLoad()
+
+	if err := chromedp.Run(loadCtx, bs.emulateDevice(profiles[0])); err != nil {
+		return capture, bs.phaseError(ctx, tab, "page load", bs.config.PageLoadDuration(), err)
+	}
+
+	redirects := trackRedirects(loadCtx)
+	response, err := chromedp.RunResponse(loadCtx, chromedp.Navigate(url))
+	capture.Redirects = redirects()
+	if response != nil {
+		capture.StatusCode = int(response.Status)
+		capture.FinalURL = response.URL
+		capture.ContentType = response.MimeType
+		capture.Headers = responseHeaders(response.Headers)
+		capture.ETag = headerValue(response.Headers, "ETag")
+		capture.LastModified = headerValue(response.Headers, "Last-Modified")
+	}
+	if err == nil {
+		err = chromedp.Run(loadCtx, chromedp.WaitReady("body", chromedp.ByQuery))
+	}
+	if err != nil {
+		return capture, bs.phaseError(ctx, tab, "page load", bs.config.PageLoadDuration(), err)
+	}
+
+	if bs.config.FailOnHTTPError && capture.StatusCode != 0 && (capture.StatusCode < 200 || capture.StatusCode > 299) {
+		return capture, fmt.Errorf("HTTP %d %s", capture.StatusCode, http.StatusText(capture.StatusCode))
+	}
+
+	captureCtx, cancelCapture := bs.phaseContext(ctx, tab, bs.config.CaptureDuration())
+	defer cancelCapture()
+
+	var links []string
 	var screenshotData []byte
-	err := chromedp.Run(bs.ctx,
-		chromedp.Navigate(url),
-		chromedp.WaitReady("body", chromedp.ByQuery),
-		chromedp.Sleep(time.Duration(bs.config.ScreenshotDelay)*time.Second),
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			return emulation.SetDeviceMetricsOverride(
-				int64(bs.config.ViewportWidth),
-				int64(bs.config.ViewportHeight),
-				1, false,
-			).Do(ctx)
-		}),
-		chromedp.FullScreenshot(&screenshotData, bs.config.Quality),
+	err = chromedp.Run(captureCtx,
+		bs.waitForPage(url, waitRule),
+		chromedp.Title(&capture.Title),
+		chromedp.Location(&capture.FinalURL),
+		chromedp.Evaluate(linkExtractionScript, &links),
+		bs.captureScreenshot(&screenshotData, rule),
 	)
+	if err != nil {
+		return capture, bs.phaseError(ctx, tab, "capture", bs.config.CaptureDuration(), err)
+	}
+
+	capture.Screenshots = append(capture.Screenshots, models.DeviceScreenshot{Device: profiles[0].Name, Data: screenshotData})
+	capture.Links = bs.filterLinks(links)
+	log.Printf("\033[32m> Extracted %d valid links from %s\033[0m", len(capture.Links), url)
+
+	for _, profile := range profiles[1:] {
+		capture.Screenshots = append(capture.Screenshots, bs.captureProfile(ctx, tab, url, profile, rule, waitRule))
+	}
+
+	return capture, nil
+}
 
-	duration := time.Since(startTime).Milliseconds()
-	result.Duration = duration
+// captureprofile switches the tab to another device profile, reloads the page and captures it,
+// the reload and the capture share one capture timeout
+func (bs *BrowserService) captureProfile(ctx context.Context, tab *browserTab, url string, profile config.DeviceProfile, rule config.CaptureRule, waitRule config.WaitRule) models.DeviceScreenshot {
+	profileCtx, cancel := bs.phaseContext(ctx, tab, bs.config.CaptureDuration())
+	defer cancel()
 
+	var data []byte
+	err := chromedp.Run(profileCtx,
+		bs.emulateDevice(profile),
+		chromedp.Reload(),
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		bs.waitForPage(url, waitRule),
+		bs.captureScreenshot(&data, rule),
+	)
 	if err != nil {
-		result.Success = false
-		result.Error = err.Error()
-		log.Printf("\033[31m> Screenshot failed for %s: %s\033[0m", url, err.Error())
-		return result
+		err = bs.phaseError(ctx, tab, "capture", bs.config.CaptureDuration(), err)
 	}
 
-	if err := os.WriteFile(filepath, screenshotData, 0644); err != nil {
-		result.Success = false
-		result.Error = fmt.Sprintf("File write error: %s", err.Error())
-		log.Printf("\033[31m> File write failed for %s: %s\033[0m", filename, err.Error())
-		return result
+	return models.DeviceScreenshot{Device: profile.Name, Data: data, Err: err}
+}
+
+// phasecontext derives a context for one phase of a page from the tab, limited to the given timeout
+// and cancelled as soon as ctx is done, so a crawl timeout also interrupts a running page
+func (bs *BrowserService) phaseContext(ctx context.Context, tab *browserTab, timeout time.Duration) (context.Context, context.CancelFunc) {
+	phaseCtx, cancel := context.WithTimeout(tab.ctx, timeout)
+	stop := context.AfterFunc(ctx, cancel)
+	return phaseCtx, func() {
+		stop()
+		cancel()
 	}
+}
 
-	if fileInfo, err := os.Stat(filepath); err == nil {
-		result.FileSize = fileInfo.Size()
+// phaseerror describes an error of a page phase, a phase that ran out of time is reported as a timeout
+// wrapping context.deadlineexceeded and one interrupted by ctx carries the cause of ctx, in both cases
+// the tab is replaced because the page may still be loading in it
+func (bs *BrowserService) phaseError(ctx context.Context, tab *browserTab, phase string, timeout time.Duration, err error) error {
+	if ctx.Err() != nil {
+		tab.timedOut.Store(true)
+		return fmt.Errorf("%s interrupted: %w", phase, context.Cause(ctx))
 	}
 
-	result.Success = true
-	log.Printf("\033[32m> Screenshot saved: %s (%.2fKB)\033[0m", filename, float64(result.FileSize)/1024)
+	if errors.Is(err, context.DeadlineExceeded) {
+		tab.timedOut.Store(true)
+		return fmt.Errorf("%s timed out after %s: %w", phase, timeout, context.DeadlineExceeded)
+	}
 
-	return result
+	return err
 }
 
-// extractlinks navigates to the url, extracts all links, filters and normalizes valid ones
-func (bs *BrowserService) ExtractLinks(url string) ([]string, error) {
-	var links []string
+// loadeventscript resolves once the window load event fired
+const loadEventScript = `
+	new Promise(resolve => {
+		if (document.readyState === 'complete') {
+			resolve(true);
+			return;
+		}
+		window.addEventListener('load', () => resolve(true), {once: true});
+	});
+`
 
-	err := chromedp.Run(bs.ctx,
-		chromedp.Navigate(url),
-		chromedp.WaitReady("body", chromedp.ByQuery),
-		chromedp.Sleep(time.Duration(bs.config.ScreenshotDelay)*time.Second),
-		chromedp.Evaluate(`
-			Array.from(document.querySelectorAll('a[href]')).map(link => {
-				try {
-					return new URL(link.href, window.location.href).href;
-				} catch (e) {
-					return null;
+// domcontentloadedscript resolves once the html document has been parsed
+const domContentLoadedScript = `
+	new Promise(resolve => {
+		if (document.readyState !== 'loading') {
+			resolve(true);
+			return;
+		}
+		document.addEventListener('DOMContentLoaded', () => resolve(true), {once: true});
+	});
+`
+
+// resourcesloadedscript resolves once web fonts are ready and every image has loaded or failed
+const resourcesLoadedScript = `
+	Promise.all([
+		document.fonts ? document.fonts.ready : Promise.resolve(),
+		...Array.from(document.images).filter(image => !image.complete).map(image => new Promise(resolve => {
+			image.addEventListener('load', resolve, {once: true});
+			image.addEventListener('error', resolve, {once: true});
+		})),
+	]).then(() => true);
+`
+
+// waitforpage waits until the page is ready according to the wait rule, a strategy that does not finish
+// within the wait timeout or fails falls back to the fixed screenshot delay, the delay strategy only sleeps
+func (bs *BrowserService) waitForPage(url string, rule config.WaitRule) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		delay := time.Duration(bs.config.ScreenshotDelay) * time.Second
+		if rule.Strategy == config.WAIT_DELAY {
+			return chromedp.Sleep(delay).Do(ctx)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, bs.config.WaitDuration())
+		defer cancel()
+
+		err := bs.waitStrategy(rule).Do(waitCtx)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		log.Printf("\033[33m> Wait strategy %s did not finish for %s, falling back to %s delay: %s\033[0m", rule.Strategy, url, delay, err.Error())
+		return chromedp.Sleep(delay).Do(ctx)
+	})
+}
+
+// waitstrategy returns the action that blocks until the condition of the wait rule holds
+func (bs *BrowserService) waitStrategy(rule config.WaitRule) chromedp.Action {
+	awaitPromise := func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}
+
+	switch rule.Strategy {
+	case config.WAIT_SELECTOR:
+		return chromedp.WaitVisible(rule.Selector, chromedp.ByQuery)
+	case config.WAIT_EXPRESSION:
+		return chromedp.Poll(rule.Expression, nil, chromedp.WithPollingInterval(100*time.Millisecond), chromedp.WithPollingTimeout(bs.config.WaitDuration()))
+	case config.WAIT_LOAD:
+		return chromedp.Evaluate(loadEventScript, nil, awaitPromise)
+	case config.WAIT_DOM_CONTENT_LOADED:
+		return chromedp.Evaluate(domContentLoadedScript, nil, awaitPromise)
+	case config.WAIT_RESOURCES:
+		return chromedp.Evaluate(resourcesLoadedScript, nil, awaitPromise)
+	default:
+		return waitNetworkIdle(time.Duration(rule.IdleTime) * time.Millisecond)
+	}
+}
+
+// waitnetworkidle blocks until no request of the page has been pending for the given idle time,
+// requests are tracked from the moment the wait starts
+func waitNetworkIdle(idle time.Duration) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		var mu sync.Mutex
+		pending := make(map[network.RequestID]bool)
+		lastActivity := time.Now()
+
+		listenCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		chromedp.ListenTarget(listenCtx, func(ev any) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch ev := ev.(type) {
+			case *network.EventRequestWillBeSent:
+				pending[ev.RequestID] = true
+			case *network.EventLoadingFinished:
+				delete(pending, ev.RequestID)
+			case *network.EventLoadingFailed:
+				delete(pending, ev.RequestID)
+			default:
+				return
+			}
+			lastActivity = time.Now()
+		})
+
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+				mu.Lock()
+				idleFor := time.Since(lastActivity)
+				busy := len(pending) > 0
+				mu.Unlock()
+				if !busy && idleFor >= idle {
+					return nil
 				}
-			}).filter(href => href !== null);
-		`, &links),
-	)
+			}
+		}
+	})
+}
 
-	if err != nil {
-		log.Printf("\033[31m> Link extraction failed for %s: %s\033[0m", url, err.Error())
-		return nil, err
+// elementrectscript returns the document position and size of the first element matching a selector,
+// or null when nothing matches
+const elementRectScript = `
+	(() => {
+		const element = document.querySelector(%q);
+		if (!element) {
+			return null;
+		}
+		const rect = element.getBoundingClientRect();
+		return {x: rect.left + window.scrollX, y: rect.top + window.scrollY, width: rect.width, height: rect.height};
+	})();
+`
+
+// capturescreenshot captures the part of the page selected by the capture rule in the configured image format,
+// quality only applies to jpeg and webp
+func (bs *BrowserService) captureScreenshot(res *[]byte, rule config.CaptureRule) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		format, quality := screenshotFormat(bs.config.ImageFormat, bs.config.Quality)
+		params := page.CaptureScreenshot().WithFromSurface(true).WithFormat(format)
+		if quality > 0 {
+			params = params.WithQuality(quality)
+		}
+
+		switch rule.Mode {
+		case config.CAPTURE_MODE_VIEWPORT:
+		case config.CAPTURE_MODE_ELEMENT:
+			var rect *config.ClipRect
+			if err := chromedp.Evaluate(fmt.Sprintf(elementRectScript, rule.Selector), &rect).Do(ctx); err != nil {
+				return err
+			}
+			if rect == nil || rect.Width <= 0 || rect.Height <= 0 {
+				return fmt.Errorf("no visible element matches selector %q", rule.Selector)
+			}
+			params = params.WithCaptureBeyondViewport(true).WithClip(clipViewport(*rect))
+		case config.CAPTURE_MODE_CLIP:
+			rect, err := config.ParseClip(rule.Clip)
+			if err != nil {
+				return err
+			}
+			params = params.WithCaptureBeyondViewport(true).WithClip(clipViewport(rect))
+		default:
+			params = params.WithCaptureBeyondViewport(true)
+		}
+
+		data, err := params.Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		*res = data
+		return nil
+	})
+}
+
+// screenshotformat returns the capture format for the configured image format and the quality to encode it with,
+// the quality is zero for png, which is lossless
+func screenshotFormat(imageFormat string, quality int) (page.CaptureScreenshotFormat, int64) {
+	switch imageFormat {
+	case config.IMAGE_FORMAT_JPEG:
+		return page.CaptureScreenshotFormatJpeg, int64(quality)
+	case config.IMAGE_FORMAT_WEBP:
+		return page.CaptureScreenshotFormatWebp, int64(quality)
+	default:
+		return page.CaptureScreenshotFormatPng, 0
+	}
+}
+
+// clipviewport converts a clip rectangle into the viewport type used by page.capturescreenshot
+func clipViewport(rect config.ClipRect) *page.Viewport {
+	return &page.Viewport{
+		X:      rect.X,
+		Y:      rect.Y,
+		Width:  rect.Width,
+		Height: rect.Height,
+		Scale:  1,
+	}
+}
+
+// emulatedevice sets the viewport, scale factor, touch support and user agent of a device profile,
+// every value is set explicitly because tabs are reused across pages and profiles
+func (bs *BrowserService) emulateDevice(profile config.DeviceProfile) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		userAgent := profile.UserAgent
+		if userAgent == "" {
+			userAgent = bs.config.UserAgent
+		}
+
+		if err := emulation.SetDeviceMetricsOverride(
+			int64(profile.Width),
+			int64(profile.Height),
+			profile.ScaleFactor, profile.Mobile,
+		).Do(ctx); err != nil {
+			return err
+		}
+
+		if err := emulation.SetTouchEmulationEnabled(profile.Touch).Do(ctx); err != nil {
+			return err
+		}
+
+		return emulation.SetUserAgentOverride(userAgent).Do(ctx)
+	})
+}
+
+// trackredirects starts recording the redirect hops of the first document request sent after it is called,
+// chrome reuses the request id for every hop, the returned function reports the hops seen so far
+func trackRedirects(ctx context.Context) func() []models.Redirect {
+	var mu sync.Mutex
+	var requestID network.RequestID
+	var redirects []models.Redirect
+
+	chromedp.ListenTarget(ctx, func(ev any) {
+		request, ok := ev.(*network.EventRequestWillBeSent)
+		if !ok || request.Type != network.ResourceTypeDocument {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if requestID == "" {
+			requestID = request.RequestID
+		}
+		if request.RequestID == requestID && request.RedirectResponse != nil {
+			redirects = append(redirects, models.Redirect{
+				URL:        request.RedirectResponse.URL,
+				StatusCode: int(request.RedirectResponse.Status),
+			})
+		}
+	})
+
+	return func() []models.Redirect {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]models.Redirect(nil), redirects...)
 	}
+}
+
+// responseheaders converts the headers of a cdp response into plain strings
+func responseHeaders(headers network.Headers) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	converted := make(map[string]string, len(headers))
+	for key, value := range headers {
+		converted[key] = fmt.Sprint(value)
+	}
+	return converted
+}
 
+// headervalue returns a response header by name, matched case-insensitively
+func headerValue(headers network.Headers, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// filterlinks keeps valid same-site links, dropping duplicates by their normalized form
+func (bs *BrowserService) filterLinks(links []string) []string {
 	validLinks := make([]string, 0)
 	seenLinks := make(map[string]bool)
 
 	for _, link := range links {
-		if utils.IsValidURL(link, bs.config.BaseURL) && !seenLinks[link] {
-			normalizedLink := utils.NormalizeURL(link)
+		if utils.IsValidURL(link, bs.config.BaseURL, bs.config.URLPolicy()) && !seenLinks[link] {
+			normalizedLink := utils.NormalizeURL(link, bs.config.URLPolicy())
 			if !seenLinks[normalizedLink] {
 				validLinks = append(validLinks, link)
 				seenLinks[normalizedLink] = true
@@ -145,13 +572,19 @@ func (bs *BrowserService) ExtractLinks(url string) ([]string, error) {
 		}
 	}
 
-	log.Printf("\033[32m> Extracted %d valid links from %s\033[0m", len(validLinks), url)
-	return validLinks, nil
+	return validLinks
 }
 
-// testconnection navigates to the url and checks if the page loads successfully
+// testconnection navigates to the url and checks if the page loads successfully within the page load timeout
 func (bs *BrowserService) TestConnection(url string) error {
-	err := chromedp.Run(bs.ctx,
+	if err := bs.start(); err != nil {
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(bs.ctx, bs.config.PageLoadDuration())
+	defer cancel()
+
+	err := chromedp.Run(ctx,
 		chromedp.Navigate(url),
 		chromedp.WaitReady("body", chromedp.ByQuery),
 	)
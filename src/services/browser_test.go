@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/chromedp/cdproto/page"
+
+	"framely/src/config"
+)
+
+// testscreenshotformat checks that every image format maps to its capture format and file extension,
+// and that the quality is only passed on for the lossy formats
+func TestScreenshotFormat(t *testing.T) {
+	tests := []struct {
+		imageFormat   string
+		wantFormat    page.CaptureScreenshotFormat
+		wantQuality   int64
+		wantExtension string
+	}{
+		{config.IMAGE_FORMAT_PNG, page.CaptureScreenshotFormatPng, 0, ".png"},
+		{config.IMAGE_FORMAT_JPEG, page.CaptureScreenshotFormatJpeg, 80, ".jpg"},
+		{config.IMAGE_FORMAT_WEBP, page.CaptureScreenshotFormatWebp, 80, ".webp"},
+		{"", page.CaptureScreenshotFormatPng, 0, ".png"},
+	}
+
+	for _, test := range tests {
+		format, quality := screenshotFormat(test.imageFormat, 80)
+		if format != test.wantFormat || quality != test.wantQuality {
+			t.Errorf("screenshotFormat(%q) = %s, %d, want %s, %d", test.imageFormat, format, quality, test.wantFormat, test.wantQuality)
+		}
+
+		cfg := config.NewConfig("https://example.com")
+		cfg.ImageFormat = test.imageFormat
+		if extension := cfg.ImageExtension(); extension != test.wantExtension {
+			t.Errorf("ImageExtension(%q) = %s, want %s", test.imageFormat, extension, test.wantExtension)
+		}
+	}
+}
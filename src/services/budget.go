@@ -0,0 +1,65 @@
+package services
+
+import (
+	"sync"
+
+	"framely/src/utils"
+)
+
+const EXCLUDED_BY_PREFIX_LIMIT = "max-pages-per-prefix"
+
+// pagebudget counts captured pages against the total page limit and the limit per path prefix,
+// a limit of zero means no limit
+type pageBudget struct {
+	mu             sync.Mutex
+	maxPages       int
+	maxPrefixPages int
+	pages          int
+	prefixPages    map[string]int
+}
+
+// newpagebudget creates a page budget with the given limits
+func newPageBudget(maxPages, maxPrefixPages int) *pageBudget {
+	return &pageBudget{
+		maxPages:       maxPages,
+		maxPrefixPages: maxPrefixPages,
+		prefixPages:    make(map[string]int),
+	}
+}
+
+// take reserves one page for the url, it returns the limit that rejected the url, STOP_REASON_MAX_PAGES
+// or EXCLUDED_BY_PREFIX_LIMIT, or an empty string when the page may be captured, and whether this page
+// used up the total limit, a full path prefix only rejects urls under that prefix
+func (pb *pageBudget) take(url string) (limit string, exhausted bool) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if pb.maxPages > 0 && pb.pages >= pb.maxPages {
+		return STOP_REASON_MAX_PAGES, true
+	}
+
+	prefix := utils.PathPrefix(url)
+	if pb.maxPrefixPages > 0 && pb.prefixPages[prefix] >= pb.maxPrefixPages {
+		return EXCLUDED_BY_PREFIX_LIMIT, false
+	}
+
+	pb.pages++
+	pb.prefixPages[prefix]++
+
+	return "", pb.maxPages > 0 && pb.pages >= pb.maxPages
+}
+
+// refund gives back the page reserved for the url by take, for pages that were cut off before
+// their capture finished
+func (pb *pageBudget) refund(url string) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	prefix := utils.PathPrefix(url)
+	if pb.pages > 0 {
+		pb.pages--
+	}
+	if pb.prefixPages[prefix] > 0 {
+		pb.prefixPages[prefix]--
+	}
+}
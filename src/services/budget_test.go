@@ -0,0 +1,77 @@
+package services
+
+import "testing"
+
+// testpagebudgettotallimit checks that the page that reaches the total limit is allowed and reports
+// the budget as exhausted, and that every later page is rejected by the total limit
+func TestPageBudgetTotalLimit(t *testing.T) {
+	budget := newPageBudget(2, 0)
+
+	tests := []struct {
+		url           string
+		wantLimit     string
+		wantExhausted bool
+	}{
+		{"https://example.com/", "", false},
+		{"https://example.com/about", "", true},
+		{"https://example.com/contact", STOP_REASON_MAX_PAGES, true},
+	}
+
+	for _, test := range tests {
+		limit, exhausted := budget.take(test.url)
+		if limit != test.wantLimit || exhausted != test.wantExhausted {
+			t.Errorf("take(%q) = %q, %v, want %q, %v", test.url, limit, exhausted, test.wantLimit, test.wantExhausted)
+		}
+	}
+}
+
+// testpagebudgetprefixlimit checks that a full path prefix only rejects urls under that prefix and
+// that rejected urls do not use up the total limit
+func TestPageBudgetPrefixLimit(t *testing.T) {
+	budget := newPageBudget(3, 1)
+
+	tests := []struct {
+		url       string
+		wantLimit string
+	}{
+		{"https://example.com/blog/first", ""},
+		{"https://example.com/blog/second", EXCLUDED_BY_PREFIX_LIMIT},
+		{"https://example.com/blog", EXCLUDED_BY_PREFIX_LIMIT},
+		{"https://example.com/products/shoes", ""},
+		{"https://example.com/", ""},
+	}
+
+	for _, test := range tests {
+		if limit, _ := budget.take(test.url); limit != test.wantLimit {
+			t.Errorf("take(%q) = %q, want %q", test.url, limit, test.wantLimit)
+		}
+	}
+
+	if limit, exhausted := budget.take("https://example.com/about"); limit != STOP_REASON_MAX_PAGES || !exhausted {
+		t.Errorf("take after three pages = %q, %v, want the total limit", limit, exhausted)
+	}
+}
+
+// testpagebudgetrefund checks that a refunded page frees its slot in the total and the prefix limit
+func TestPageBudgetRefund(t *testing.T) {
+	budget := newPageBudget(1, 1)
+
+	if limit, _ := budget.take("https://example.com/blog/first"); limit != "" {
+		t.Fatalf("first page rejected by %q", limit)
+	}
+	budget.refund("https://example.com/blog/first")
+
+	if limit, exhausted := budget.take("https://example.com/blog/second"); limit != "" || !exhausted {
+		t.Fatalf("page after refund = %q, %v, want it allowed and the budget exhausted", limit, exhausted)
+	}
+}
+
+// testpagebudgetunlimited checks that zero limits never reject a page
+func TestPageBudgetUnlimited(t *testing.T) {
+	budget := newPageBudget(0, 0)
+	for i := 0; i < 100; i++ {
+		if limit, exhausted := budget.take("https://example.com/blog/post"); limit != "" || exhausted {
+			t.Fatalf("take %d = %q, %v, want no limit", i, limit, exhausted)
+		}
+	}
+}
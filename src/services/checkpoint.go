@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"framely/src/config"
+	"framely/src/models"
+)
+
+// savecheckpoint writes the session checkpoint to the output directory, it writes a temporary file
+// first and renames it so a crash while saving never leaves a truncated checkpoint behind
+func (rs *ReportService) SaveCheckpoint(checkpoint models.SessionCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	checkpointPath := filepath.Join(rs.outputDir, config.CHECKPOINT_FILE)
+	tempPath := checkpointPath + ".tmp"
+
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tempPath, checkpointPath); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// loadcheckpoint loads the session checkpoint from the output directory
+func (rs *ReportService) LoadCheckpoint() (*models.SessionCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(rs.outputDir, config.CHECKPOINT_FILE))
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint models.SessionCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+// removecheckpoint deletes the session checkpoint once the crawl has finished, a missing file is not an error
+func (rs *ReportService) RemoveCheckpoint() error {
+	err := os.Remove(filepath.Join(rs.outputDir, config.CHECKPOINT_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
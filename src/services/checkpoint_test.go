@@ -0,0 +1,106 @@
+package services
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"framely/src/config"
+	"framely/src/models"
+)
+
+// testcheckpointroundtrip checks that a saved checkpoint loads back unchanged and that no temporary
+// file is left in the output directory
+func TestCheckpointRoundTrip(t *testing.T) {
+	cfg := config.NewConfig("https://example.com")
+	cfg.OutputDir = t.TempDir()
+	rs := NewReportService(cfg)
+
+	saved := models.SessionCheckpoint{
+		BaseURL:  "https://example.com",
+		SavedAt:  time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		Queue:    []models.FrontierURL{{URL: "https://example.com/queued", Depth: 2, Priority: 0.8}},
+		Visited:  []string{"https://example.com/"},
+		Excluded: map[string]string{"https://example.com/admin": "exclude:glob:/admin/**"},
+		Results:  []models.ScreenshotResult{{URL: "https://example.com/", Filename: "index.png", Success: true}},
+	}
+
+	if err := rs.SaveCheckpoint(saved); err != nil {
+		t.Fatalf("SaveCheckpoint error: %v", err)
+	}
+	loaded, err := rs.LoadCheckpoint()
+	if err != nil {
+		t.Fatalf("LoadCheckpoint error: %v", err)
+	}
+	if !reflect.DeepEqual(*loaded, saved) {
+		t.Fatalf("loaded checkpoint = %+v, want %+v", *loaded, saved)
+	}
+
+	entries, err := os.ReadDir(cfg.OutputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != config.CHECKPOINT_FILE {
+		t.Fatalf("output directory holds %v, want only the checkpoint", entries)
+	}
+
+	if err := rs.RemoveCheckpoint(); err != nil {
+		t.Fatalf("RemoveCheckpoint error: %v", err)
+	}
+	if err := rs.RemoveCheckpoint(); err != nil {
+		t.Fatalf("RemoveCheckpoint without a checkpoint = %v, want nil", err)
+	}
+}
+
+// testresumesessionskipsreportedresults checks that resuming restores the queue and exclusions, drops
+// results that report.json already holds, and charges every restored page against the page budget
+func TestResumeSessionSkipsReportedResults(t *testing.T) {
+	cfg := config.NewConfig("https://example.com")
+	cfg.OutputDir = t.TempDir()
+	cfg.MaxPages = 2
+
+	capturedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	reported := models.ScreenshotResult{URL: "https://example.com/", Filename: "index.png", Success: true, Timestamp: capturedAt}
+	unreported := models.ScreenshotResult{URL: "https://example.com/about", Filename: "about.png", Success: true, Timestamp: capturedAt}
+
+	as := newTestAppService(cfg)
+	as.reportService = NewReportService(cfg)
+	as.budget = newPageBudget(cfg.MaxPages, cfg.MaxPrefixPages)
+	as.previousResults = map[string][]models.ScreenshotResult{"https://example.com/": {reported}}
+
+	if err := as.reportService.SaveCheckpoint(models.SessionCheckpoint{
+		BaseURL:  "https://example.com/",
+		Queue:    []models.FrontierURL{{URL: "https://example.com/contact", Depth: 1}},
+		Visited:  []string{"https://example.com/", "https://example.com/about"},
+		Excluded: map[string]string{"https://example.com/admin": "exclude:glob:/admin/**"},
+		Results:  []models.ScreenshotResult{reported, unreported},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := as.resumeSession(); err != nil {
+		t.Fatalf("resumeSession error: %v", err)
+	}
+
+	results := as.session.GetResults()
+	if len(results) != 1 || results[0].URL != unreported.URL {
+		t.Fatalf("restored results = %+v, want only the page missing from report.json", results)
+	}
+	if url, _, ok := as.session.GetNextURL(); !ok || url != "https://example.com/contact" {
+		t.Fatalf("next url = %q, want the queued contact page", url)
+	}
+	if counts := as.session.ExclusionCounts(); counts["exclude:glob:/admin/**"] != 1 {
+		t.Fatalf("exclusion counts = %v, want the checkpointed exclusion", counts)
+	}
+	if limit, _ := as.budget.take("https://example.com/contact"); limit != STOP_REASON_MAX_PAGES {
+		t.Fatalf("take after resume = %q, want the page limit used up by the two restored pages", limit)
+	}
+
+	other := newTestAppService(config.NewConfig("https://other.example"))
+	other.reportService = as.reportService
+	other.budget = newPageBudget(0, 0)
+	if err := other.resumeSession(); err == nil {
+		t.Fatal("checkpoint of another site was resumed")
+	}
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/webp"
+
+	"framely/src/config"
+	"framely/src/models"
+)
+
+const (
+	DIFF_STATUS_COMPARED         = "compared"
+	DIFF_STATUS_MISSING_BASELINE = "missing_baseline"
+	DIFF_STATUS_MISSING_CURRENT  = "missing_current"
+	DIFF_STATUS_ERROR            = "error"
+)
+
+// diffservice compares the screenshots of two runs and writes diff images and reports
+type DiffService struct {
+	threshold float64
+	outputDir string
+}
+
+// newdiffservice creates a new diffservice that flags pages above the threshold percentage
+// and writes its output to the given directory
+func NewDiffService(threshold float64, outputDir string) *DiffService {
+	return &DiffService{
+		threshold: threshold,
+		outputDir: outputDir,
+	}
+}
+
+// comparedirectories pairs successful results from the report.json of both directories by url and device,
+// using the url normalization policy stored in the current report, compares every pair pixel by pixel,
+// and saves the diff report and summary
+func (ds *DiffService) CompareDirectories(baselineDir, currentDir string) (*models.DiffReport, error) {
+	baseline, err := loadReport(baselineDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load baseline report: %w", err)
+	}
+
+	current, err := loadReport(currentDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load current report: %w", err)
+	}
+
+	diffDir := filepath.Join(ds.outputDir, config.DIFF_DIR)
+	if err := os.MkdirAll(diffDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create diff directory: %w", err)
+	}
+
+	policy := reportURLPolicy(current, baseline)
+	baselineResults := successfulResultsByKey(baseline.Results, policy)
+	currentResults := successfulResultsByKey(current.Results, policy)
+
+	keys := make([]string, 0, len(baselineResults)+len(currentResults))
+	for key := range baselineResults {
+		keys = append(keys, key)
+	}
+	for key := range currentResults {
+		if _, ok := baselineResults[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	report := &models.DiffReport{
+		BaselineDir: baselineDir,
+		CurrentDir:  currentDir,
+		Threshold:   ds.threshold,
+		Timestamp:   time.Now(),
+		Results:     make([]models.DiffResult, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		result := ds.comparePair(baselineResults[key], currentResults[key], baselineDir, currentDir)
+
+		switch result.Status {
+		case DIFF_STATUS_COMPARED:
+			report.ComparedPages++
+			if result.Changed {
+				report.ChangedPages++
+				log.Printf("\033[31m> Changed %.2f%%: %s\033[0m", result.DiffPercent, result.URL)
+			}
+		case DIFF_STATUS_ERROR:
+			report.FailedPages++
+			log.Printf("\033[31m> Diff failed for %s: %s\033[0m", result.URL, result.Error)
+		default:
+			report.MissingPages++
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	if err := ds.saveReport(report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// reporturlpolicy returns the url normalization policy the first of the reports was written with,
+// reports written before the policy was stored fall back to the default policy
+func reportURLPolicy(reports ...*models.Report) config.URLPolicy {
+	for _, report := range reports {
+		if report.URLPolicy != nil {
+			return *report.URLPolicy
+		}
+	}
+	return config.DefaultURLPolicy()
+}
+
+// successfulresultsbykey indexes successful results by url and device, urls are normalized with the given policy
+func successfulResultsByKey(results []models.ScreenshotResult, policy config.URLPolicy) map[string]*models.ScreenshotResult {
+	indexed := make(map[string]*models.ScreenshotResult)
+	for i := range results {
+		if results[i].Success {
+			indexed[results[i].Key(policy)] = &results[i]
+		}
+	}
+	return indexed
+}
+
+// comparepair compares the baseline and current screenshot of one page, either side may be missing
+func (ds *DiffService) comparePair(baseline, current *models.ScreenshotResult, baselineDir, currentDir string) models.DiffResult {
+	if baseline == nil {
+		return models.DiffResult{URL: current.URL, Device: current.Device, CurrentFile: current.Filename, Status: DIFF_STATUS_MISSING_BASELINE}
+	}
+	if current == nil {
+		return models.DiffResult{URL: baseline.URL, Device: baseline.Device, BaselineFile: baseline.Filename, Status: DIFF_STATUS_MISSING_CURRENT}
+	}
+
+	result := models.DiffResult{
+		URL:          current.URL,
+		Device:       current.Device,
+		BaselineFile: baseline.Filename,
+		CurrentFile:  current.Filename,
+		Status:       DIFF_STATUS_COMPARED,
+	}
+
+	baselineImage, err := loadImage(filepath.Join(baselineDir, baseline.Filename))
+	if err != nil {
+		result.Status = DIFF_STATUS_ERROR
+		result.Error = fmt.Sprintf("baseline image: %s", err.Error())
+		return result
+	}
+
+	currentImage, err := loadImage(filepath.Join(currentDir, current.Filename))
+	if err != nil {
+		result.Status = DIFF_STATUS_ERROR
+		result.Error = fmt.Sprintf("current image: %s", err.Error())
+		return result
+	}
+
+	diffImage, percent := DiffImages(baselineImage, currentImage)
+	result.DiffPercent = percent
+	result.Changed = percent > ds.threshold
+
+	if percent > 0 {
+		diffFile := filepath.Join(config.DIFF_DIR, strings.TrimSuffix(current.Filename, filepath.Ext(current.Filename))+"_diff.png")
+		if err := saveImage(filepath.Join(ds.outputDir, diffFile), diffImage); err != nil {
+			result.Status = DIFF_STATUS_ERROR
+			result.Error = fmt.Sprintf("diff image write error: %s", err.Error())
+			return result
+		}
+		result.DiffFile = diffFile
+	}
+
+	return result
+}
+
+// diffimages compares two images pixel by pixel and returns a highlighted diff image with the percentage
+// of differing pixels, pixels outside the overlapping area count as different, the diff image shows the
+// current screenshot faded with every differing pixel painted red
+func DiffImages(baseline, current image.Image) (*image.RGBA, float64) {
+	baseBounds := baseline.Bounds()
+	currentBounds := current.Bounds()
+
+	width := max(baseBounds.Dx(), currentBounds.Dx())
+	height := max(baseBounds.Dy(), currentBounds.Dy())
+	diff := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	if width == 0 || height == 0 {
+		return diff, 0
+	}
+
+	highlight := color.RGBA{R: 255, A: 255}
+	changed := 0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			inBase := x < baseBounds.Dx() && y < baseBounds.Dy()
+			inCurrent := x < currentBounds.Dx() && y < currentBounds.Dy()
+
+			if !inBase || !inCurrent {
+				diff.SetRGBA(x, y, highlight)
+				changed++
+				continue
+			}
+
+			basePixel := baseline.At(baseBounds.Min.X+x, baseBounds.Min.Y+y)
+			currentPixel := current.At(currentBounds.Min.X+x, currentBounds.Min.Y+y)
+
+			if pixelsDiffer(basePixel, currentPixel) {
+				diff.SetRGBA(x, y, highlight)
+				changed++
+				continue
+			}
+
+			diff.SetRGBA(x, y, fadePixel(currentPixel))
+		}
+	}
+
+	return diff, float64(changed) * 100 / float64(width*height)
+}
+
+// pixelsdiffer reports whether any channel of the two colors differs by more than the pixel tolerance,
+// the tolerance keeps jpeg and webp compression noise from counting as a change
+func pixelsDiffer(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+
+	return channelDelta(ar, br) > config.DIFF_PIXEL_TOLERANCE ||
+		channelDelta(ag, bg) > config.DIFF_PIXEL_TOLERANCE ||
+		channelDelta(ab, bb) > config.DIFF_PIXEL_TOLERANCE ||
+		channelDelta(aa, ba) > config.DIFF_PIXEL_TOLERANCE
+}
+
+// channeldelta returns the absolute difference of two 16-bit color channels in 8-bit units
+func channelDelta(a, b uint32) uint32 {
+	a >>= 8
+	b >>= 8
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// fadepixel lightens an unchanged pixel so the highlighted changes stand out
+func fadePixel(c color.Color) color.RGBA {
+	gray := color.GrayModel.Convert(c).(color.Gray).Y
+	faded := 255 - (255-gray)/4
+	return color.RGBA{R: faded, G: faded, B: faded, A: 255}
+}
+
+// loadimage decodes a png, jpeg or webp screenshot from disk
+func loadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// saveimage encodes the image as png to the given path
+func saveImage(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// savereport writes the diff report as json and a text summary to the output directory
+func (ds *DiffService) saveReport(report *models.DiffReport) error {
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode diff report: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(ds.outputDir, config.DIFF_REPORT_FILE), reportJSON, 0644); err != nil {
+		return fmt.Errorf("failed to save diff report: %w", err)
+	}
+
+	summary := ds.buildSummaryContent(report)
+	if err := os.WriteFile(filepath.Join(ds.outputDir, config.DIFF_SUMMARY_FILE), []byte(summary), 0644); err != nil {
+		return fmt.Errorf("failed to save diff summary: %w", err)
+	}
+
+	return nil
+}
+
+// buildsummarycontent builds the diff summary as a formatted string with totals and flagged pages
+func (ds *DiffService) buildSummaryContent(report *models.DiffReport) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\033[36m> Baseline: %s\n\033[0m", report.BaselineDir))
+	sb.WriteString(fmt.Sprintf("\033[36m> Current: %s\n\033[0m", report.CurrentDir))
+	sb.WriteString(fmt.Sprintf("\033[36m> Generated: %s\n\033[0m", report.Timestamp.Format("2006-01-02 15:04:05")))
+	sb.WriteString(fmt.Sprintf("\033[36m> Threshold: %.2f%%\n\033[0m", report.Threshold))
+	sb.WriteString(fmt.Sprintf("\033[36m> Compared: %d\n\033[0m", report.ComparedPages))
+	sb.WriteString(fmt.Sprintf("\033[31m> Changed: %d\n\033[0m", report.ChangedPages))
+	sb.WriteString(fmt.Sprintf("\033[36m> Missing: %d\n\033[0m", report.MissingPages))
+	sb.WriteString(fmt.Sprintf("\033[31m> Failed: %d\n\n\033[0m", report.FailedPages))
+
+	if report.ChangedPages > 0 {
+		sb.WriteString("\033[36m> Pages above threshold:\n\033[0m")
+		for _, result := range report.Results {
+			if result.Changed {
+				sb.WriteString(fmt.Sprintf("\033[31m> CHANGED %s%s %.2f%% -> %s\n\033[0m", result.URL, deviceSuffix(result.Device), result.DiffPercent, result.DiffFile))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	if report.MissingPages > 0 {
+		sb.WriteString("\033[36m> Pages missing from one run:\n\033[0m")
+		for _, result := range report.Results {
+			if result.Status == DIFF_STATUS_MISSING_BASELINE {
+				sb.WriteString(fmt.Sprintf("\033[33m> NEW %s%s\n\033[0m", result.URL, deviceSuffix(result.Device)))
+			}
+			if result.Status == DIFF_STATUS_MISSING_CURRENT {
+				sb.WriteString(fmt.Sprintf("\033[33m> REMOVED %s%s\n\033[0m", result.URL, deviceSuffix(result.Device)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	if report.FailedPages > 0 {
+		sb.WriteString("\033[36m> Failed comparisons:\n\033[0m")
+		for _, result := range report.Results {
+			if result.Status == DIFF_STATUS_ERROR {
+				sb.WriteString(fmt.Sprintf("\033[31m> FAILED %s%s - %s\n\033[0m", result.URL, deviceSuffix(result.Device), result.Error))
+			}
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"framely/src/config"
+	"framely/src/models"
+)
+
+// testreporturlpolicykeepsquerypages checks that pages told apart by a query parameter under the policy
+// stored in the report stay separate when the diff pairs results, even when the default policy would merge them
+func TestReportURLPolicyKeepsQueryPages(t *testing.T) {
+	policy := config.DefaultURLPolicy()
+	policy.QueryAllow = []string{"variant"}
+	policy.QueryDeny = []string{"ref"}
+
+	current := &models.Report{
+		URLPolicy: &policy,
+		Results: []models.ScreenshotResult{
+			{URL: "https://example.com/shop?variant=a&ref=mail", Success: true},
+			{URL: "https://example.com/shop?variant=b", Success: true},
+		},
+	}
+	baseline := &models.Report{}
+
+	if got := reportURLPolicy(baseline); got.StripQuery || len(got.QueryAllow) != 0 {
+		t.Fatalf("policy of a report without one = %+v, want the default", got)
+	}
+
+	indexed := successfulResultsByKey(current.Results, reportURLPolicy(current, baseline))
+	if len(indexed) != 2 {
+		t.Fatalf("indexed %d pages, want 2", len(indexed))
+	}
+	if _, ok := indexed["https://example.com/shop?variant=a|"]; !ok {
+		t.Fatalf("keys = %v, want the variant=a page without the ref parameter", indexed)
+	}
+}
+
+// solidimage returns an image of the given size filled with one color
+func solidImage(width, height int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// testdiffimages checks the changed pixel percentage for identical images, changes within and beyond
+// the pixel tolerance, and images of different sizes
+func TestDiffImages(t *testing.T) {
+	gray := color.RGBA{R: 100, G: 100, B: 100, A: 255}
+
+	withPixel := func(delta uint8) *image.RGBA {
+		img := solidImage(10, 10, gray)
+		img.SetRGBA(0, 0, color.RGBA{R: 100 + delta, G: 100, B: 100, A: 255})
+		return img
+	}
+
+	tests := []struct {
+		name        string
+		baseline    image.Image
+		current     image.Image
+		wantPercent float64
+		wantSize    image.Point
+		changedAt   image.Point
+	}{
+		{"identical", solidImage(10, 10, gray), solidImage(10, 10, gray), 0, image.Pt(10, 10), image.Point{}},
+		{"within tolerance", solidImage(10, 10, gray), withPixel(config.DIFF_PIXEL_TOLERANCE), 0, image.Pt(10, 10), image.Point{}},
+		{"beyond tolerance", solidImage(10, 10, gray), withPixel(config.DIFF_PIXEL_TOLERANCE + 1), 1, image.Pt(10, 10), image.Pt(0, 0)},
+		{"taller current", solidImage(10, 10, gray), solidImage(10, 20, gray), 50, image.Pt(10, 20), image.Pt(5, 15)},
+		{"wider baseline", solidImage(20, 10, gray), solidImage(10, 10, gray), 50, image.Pt(20, 10), image.Pt(15, 5)},
+		{"empty", image.NewRGBA(image.Rect(0, 0, 0, 0)), image.NewRGBA(image.Rect(0, 0, 0, 0)), 0, image.Pt(0, 0), image.Point{}},
+	}
+
+	highlight := color.RGBA{R: 255, A: 255}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff, percent := DiffImages(test.baseline, test.current)
+			if percent != test.wantPercent {
+				t.Errorf("percent = %v, want %v", percent, test.wantPercent)
+			}
+			if size := diff.Bounds().Size(); size != test.wantSize {
+				t.Errorf("diff size = %v, want %v", size, test.wantSize)
+			}
+			if test.wantPercent > 0 && diff.RGBAAt(test.changedAt.X, test.changedAt.Y) != highlight {
+				t.Errorf("changed pixel %v is not highlighted", test.changedAt)
+			}
+			if test.wantPercent == 0 && test.wantSize.X > 0 && diff.RGBAAt(0, 0) == highlight {
+				t.Errorf("unchanged pixel is highlighted")
+			}
+		})
+	}
+}
+
+// testsuccessfulresultsbykeypairsbyurlanddevice checks that results pair by normalized url and device,
+// that failed results are left out, and that the same url on another device is a separate page
+func TestSuccessfulResultsByKeyPairsByURLAndDevice(t *testing.T) {
+	policy := config.DefaultURLPolicy()
+
+	baseline := successfulResultsByKey([]models.ScreenshotResult{
+		{URL: "https://example.com/about/", Filename: "about.png", Success: true},
+		{URL: "https://example.com/about", Device: "iphone", Filename: "about__iphone.png", Success: true},
+		{URL: "https://example.com/contact", Success: false},
+	}, policy)
+	current := successfulResultsByKey([]models.ScreenshotResult{
+		{URL: "https://EXAMPLE.com/about?utm_source=mail", Filename: "about.png", Success: true},
+		{URL: "https://example.com/contact", Filename: "contact.png", Success: true},
+	}, policy)
+
+	if len(baseline) != 2 {
+		t.Fatalf("baseline has %d pages, want 2 without the failed one", len(baseline))
+	}
+
+	key := "https://example.com/about|"
+	if baseline[key] == nil || current[key] == nil {
+		t.Fatalf("about page is not paired, baseline %v, current %v", baseline, current)
+	}
+	if baseline["https://example.com/about|iphone"] == nil {
+		t.Fatal("iphone capture is missing from the baseline")
+	}
+	if _, ok := current["https://example.com/about|iphone"]; ok {
+		t.Fatal("desktop capture was paired with the iphone key")
+	}
+	if baseline["https://example.com/contact|"] != nil || current["https://example.com/contact|"] == nil {
+		t.Fatal("contact page should only be in the current run")
+	}
+}
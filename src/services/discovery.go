@@ -1,42 +1,77 @@
 package services
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"framely/src/config"
 	"framely/src/models"
 	"framely/src/utils"
 )
 
-// discoveryservice holds baseurl and httpclient for url discovery operations
+// discoveryservice holds baseurl and httpclient for url discovery operations, the lastmod dates
+// and priorities found in sitemaps keyed by the url normalized with the url policy, the sitemaps already
+// fetched, and the robots.txt rules once fetched
 type DiscoveryService struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL      string
+	policy       config.URLPolicy
+	httpClient   *http.Client
+	lastModified map[string]time.Time
+	priorities   map[string]float64
+	sitemapsSeen map[string]bool
+	robotsOnce   sync.Once
+	robots       *robotsRules
 }
 
-// newdiscoveryservice creates a new discoveryservice instance with the given baseurl
-func NewDiscoveryService(baseURL string) *DiscoveryService {
+// newdiscoveryservice creates a new discoveryservice instance with the given baseurl, every request
+// it makes sends the given user agent so sites answer it the way they answer the browser, found urls are
+// normalized with the given policy
+func NewDiscoveryService(baseURL, userAgent string, policy config.URLPolicy) *DiscoveryService {
 	return &DiscoveryService{
 		baseURL: baseURL,
+		policy:  policy,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: userAgentTransport{userAgent: userAgent, base: http.DefaultTransport},
 		},
+		lastModified: make(map[string]time.Time),
+		priorities:   make(map[string]float64),
+		sitemapsSeen: make(map[string]bool),
 	}
 }
 
-// discoverurls discovers urls from sitemap and robots.txt based on flags, normalizes and validates them
-func (ds *DiscoveryService) DiscoverURLs(checkSitemap, checkRobots bool) []string {
+// useragenttransport sets the user agent header on every request before passing it to the base transport
+type userAgentTransport struct {
+	userAgent string
+	base      http.RoundTripper
+}
+
+// roundtrip sends a copy of the request with the user agent set
+func (uat userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", uat.userAgent)
+	return uat.base.RoundTrip(req)
+}
+
+// discoverurls discovers urls from sitemap and robots.txt based on flags, normalizes and validates them,
+// every url carries the priority and lastmod date its sitemap listed so the crawl can be ordered by them
+func (ds *DiscoveryService) DiscoverURLs(checkSitemap, checkRobots bool) []models.FrontierURL {
 	discoveredURLs := make(map[string]bool)
 
 	if checkSitemap {
 		sitemapURLs := ds.parseSitemap()
 		for _, url := range sitemapURLs {
-			normalizedURL := utils.NormalizeURL(url)
+			normalizedURL := utils.NormalizeURL(url, ds.policy)
 			discoveredURLs[normalizedURL] = true
 		}
 		log.Printf("\033[32m> Sitemap discovery: %d URLs found\033[0m", len(sitemapURLs))
@@ -45,7 +80,7 @@ func (ds *DiscoveryService) DiscoverURLs(checkSitemap, checkRobots bool) []strin
 	if checkRobots {
 		robotsURLs := ds.parseRobotsTxt()
 		for _, url := range robotsURLs {
-			normalizedURL := utils.NormalizeURL(url)
+			normalizedURL := utils.NormalizeURL(url, ds.policy)
 			discoveredURLs[normalizedURL] = true
 		}
 		log.Printf("\033[32m> Robots.txt discovery: %d URLs found\033[0m", len(robotsURLs))
@@ -54,12 +89,31 @@ func (ds *DiscoveryService) DiscoverURLs(checkSitemap, checkRobots bool) []strin
 	urls := make([]string, 0, len(discoveredURLs))
 	for url := range discoveredURLs {
 		fullURL := utils.FixRelativeURL(url, ds.baseURL)
-		if utils.IsValidURL(fullURL, ds.baseURL) {
+		if utils.IsValidURL(fullURL, ds.baseURL, ds.policy) {
 			urls = append(urls, fullURL)
 		}
 	}
+	sort.Strings(urls)
 
-	return urls
+	frontier := make([]models.FrontierURL, 0, len(urls))
+	for _, url := range urls {
+		frontier = append(frontier, ds.FrontierURL(url, 1))
+	}
+
+	return frontier
+}
+
+// frontierurl builds a queue entry for the url at the given depth with the priority and lastmod date
+// found in the sitemaps, urls no sitemap listed get the default priority of the sitemap protocol
+func (ds *DiscoveryService) FrontierURL(url string, depth int) models.FrontierURL {
+	frontierURL := models.FrontierURL{URL: url, Depth: depth, Priority: config.DEFAULT_SITEMAP_PRIORITY}
+	if priority, ok := ds.SitemapPriority(url); ok {
+		frontierURL.Priority = priority
+	}
+	if lastMod, ok := ds.SitemapLastMod(url); ok {
+		frontierURL.LastMod = lastMod
+	}
+	return frontierURL
 }
 
 // parsesitemap fetches and parses the main sitemap.xml for urls
@@ -67,95 +121,302 @@ func (ds *DiscoveryService) parseSitemap() []string {
 	return ds.fetchAndParseSitemap(ds.baseURL + "/sitemap.xml")
 }
 
-// parserobotstxt fetches robots.txt, extracts sitemap references, and parses those sitemaps for urls
+// parserobotstxt parses the sitemaps referenced by robots.txt for urls
 func (ds *DiscoveryService) parseRobotsTxt() []string {
+	allURLs := make([]string, 0)
+
+	for _, sitemapURL := range ds.loadRobots().sitemaps {
+		urls := ds.fetchAndParseSitemap(sitemapURL)
+		allURLs = append(allURLs, urls...)
+	}
+
+	return allURLs
+}
+
+// loadrobots fetches and parses robots.txt on first use, a missing file allows everything while a server
+// or network error disallows everything
+func (ds *DiscoveryService) loadRobots() *robotsRules {
+	ds.robotsOnce.Do(func() {
+		ds.robots = ds.fetchRobots()
+	})
+	return ds.robots
+}
+
+// fetchrobots downloads and parses robots.txt, following rfc 9309 a 4xx status means there are no rules,
+// while a 5xx status or a failed request is retried once and then treated as a complete disallow
+func (ds *DiscoveryService) fetchRobots() *robotsRules {
 	robotsURL := ds.baseURL + "/robots.txt"
 
+	for attempt := 1; attempt <= ROBOTS_FETCH_ATTEMPTS; attempt++ {
+		if attempt > 1 {
+			time.Sleep(ROBOTS_RETRY_DELAY)
+		}
+
+		rules, err := ds.fetchRobotsOnce(robotsURL)
+		if err == nil {
+			return rules
+		}
+		log.Printf("\033[31m> Robots.txt fetch error (attempt %d/%d): %s\033[0m", attempt, ROBOTS_FETCH_ATTEMPTS, err.Error())
+	}
+
+	log.Printf("\033[31m> Robots.txt unreachable, treating the whole site as disallowed, use --ignore-robots for sites you own\033[0m")
+	return &robotsRules{disallowAll: true}
+}
+
+// fetchrobotsonce requests robots.txt once, it returns an error for a 5xx status or a failed request
+func (ds *DiscoveryService) fetchRobotsOnce(robotsURL string) (*robotsRules, error) {
 	resp, err := ds.httpClient.Get(robotsURL)
 	if err != nil {
-		log.Printf("\033[31m> Robots.txt fetch error: %s\033[0m", err.Error())
-		return []string{}
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("\033[31m> Robots.txt not accessible: HTTP %d\033[0m", resp.StatusCode)
-		return []string{}
+		return &robotsRules{}, nil
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("\033[31m> Robots.txt read error: %s\033[0m", err.Error())
-		return []string{}
+		return nil, err
 	}
 
-	sitemapURLs := ds.extractSitemapReferences(string(body))
-	allURLs := make([]string, 0)
+	return parseRobots(string(body)), nil
+}
 
-	for _, sitemapURL := range sitemapURLs {
-		urls := ds.fetchAndParseSitemap(sitemapURL)
-		allURLs = append(allURLs, urls...)
+// fetchandparsesitemap fetches a sitemap url and parses it for valid urls, sitemap indexes are followed
+// recursively, gzip and plain text sitemaps are supported
+func (ds *DiscoveryService) fetchAndParseSitemap(sitemapURL string) []string {
+	return ds.fetchSitemap(strings.TrimSpace(sitemapURL), 0)
+}
+
+// fetchsitemap fetches one sitemap, returning its urls or, for a sitemap index, the urls of every
+// sitemap it lists, sitemaps already fetched are skipped so cycles between indexes end
+func (ds *DiscoveryService) fetchSitemap(sitemapURL string, nesting int) []string {
+	if ds.sitemapsSeen[sitemapURL] {
+		return []string{}
 	}
+	ds.sitemapsSeen[sitemapURL] = true
 
-	return allURLs
-}
+	if nesting > config.SITEMAP_MAX_NESTING {
+		log.Printf("\033[31m> Sitemap nesting too deep, skipping %s\033[0m", sitemapURL)
+		return []string{}
+	}
 
-// extractsitemapreferences extracts sitemap urls from robots.txt content
-func (ds *DiscoveryService) extractSitemapReferences(robotsContent string) []string {
-	lines := strings.Split(robotsContent, "\n")
-	sitemapURLs := make([]string, 0)
+	body, err := ds.fetchSitemapBody(sitemapURL)
+	if err != nil {
+		log.Printf("\033[31m> Sitemap fetch error (%s): %s\033[0m", sitemapURL, err.Error())
+		return []string{}
+	}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(strings.ToLower(line), "sitemap:") {
-			sitemapURL := strings.TrimSpace(strings.TrimPrefix(line, "Sitemap:"))
-			sitemapURL = strings.TrimSpace(strings.TrimPrefix(sitemapURL, "sitemap:"))
+	content := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	if !bytes.HasPrefix(content, []byte("<")) {
+		return ds.parseTextSitemap(sitemapURL, string(content))
+	}
+
+	if sitemapRoot(content) == "sitemapindex" {
+		var index models.SitemapIndex
+		if err := xml.Unmarshal(content, &index); err != nil {
+			log.Printf("\033[31m> Sitemap index parse error (%s): %s\033[0m", sitemapURL, err.Error())
+			return []string{}
+		}
 
-			if strings.HasPrefix(sitemapURL, "http") {
-				sitemapURLs = append(sitemapURLs, sitemapURL)
+		urls := make([]string, 0)
+		for _, sitemap := range index.Sitemaps {
+			if loc := strings.TrimSpace(sitemap.Loc); loc != "" {
+				urls = append(urls, ds.fetchSitemap(loc, nesting+1)...)
 			}
 		}
+		return urls
+	}
+
+	var urlset models.URLSet
+	if err := xml.Unmarshal(content, &urlset); err != nil {
+		log.Printf("\033[31m> Sitemap parse error (%s): %s\033[0m", sitemapURL, err.Error())
+		return []string{}
+	}
+
+	if len(urlset.URLs) > config.SITEMAP_MAX_URLS {
+		log.Printf("\033[31m> Sitemap %s lists %d URLs, only the first %d are used\033[0m", sitemapURL, len(urlset.URLs), config.SITEMAP_MAX_URLS)
+		urlset.URLs = urlset.URLs[:config.SITEMAP_MAX_URLS]
+	}
+
+	urls := make([]string, 0, len(urlset.URLs))
+	for _, url := range urlset.URLs {
+		url.Loc = strings.TrimSpace(url.Loc)
+		if ds.recordSitemapURL(url) {
+			urls = append(urls, url.Loc)
+		}
 	}
 
-	return sitemapURLs
+	return urls
 }
 
-// fetchandparsesitemap fetches a sitemap url and parses it for valid urls
-func (ds *DiscoveryService) fetchAndParseSitemap(sitemapURL string) []string {
+// fetchsitemapbody downloads a sitemap, decompressing it when it is gzipped, and rejects sitemaps
+// larger than the 50mb limit of the sitemap protocol
+func (ds *DiscoveryService) fetchSitemapBody(sitemapURL string) ([]byte, error) {
 	resp, err := ds.httpClient.Get(sitemapURL)
 	if err != nil {
-		log.Printf("\033[31m> Sitemap fetch error (%s): %s\033[0m", sitemapURL, err.Error())
-		return []string{}
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("\033[31m> Sitemap not accessible (%s): HTTP %d\033[0m", sitemapURL, resp.StatusCode)
-		return []string{}
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readLimited(resp.Body, config.SITEMAP_MAX_BYTES)
 	if err != nil {
-		log.Printf("\033[31m> Sitemap read error (%s): %s\033[0m", sitemapURL, err.Error())
-		return []string{}
+		return nil, err
 	}
 
-	var urlset models.URLSet
-	if err := xml.Unmarshal(body, &urlset); err != nil {
-		log.Printf("\033[31m> Sitemap parse error (%s): %s\033[0m", sitemapURL, err.Error())
-		return []string{}
+	if !bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		return body, nil
 	}
 
-	urls := make([]string, 0, len(urlset.URLs))
-	for _, url := range urlset.URLs {
-		if url.Loc != "" && utils.IsValidURL(url.Loc, ds.baseURL) {
-			urls = append(urls, url.Loc)
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip data: %w", err)
+	}
+	defer reader.Close()
+
+	return readLimited(reader, config.SITEMAP_MAX_BYTES)
+}
+
+// readlimited reads at most limit bytes and fails when there is more
+func readLimited(reader io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("sitemap exceeds the %d MB size limit", limit/(1024*1024))
+	}
+	return body, nil
+}
+
+// sitemaproot returns the local name of the root element of an xml sitemap
+func sitemapRoot(content []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
 		}
 	}
+}
 
+// parsetextsitemap reads a plain text sitemap with one url per line
+func (ds *DiscoveryService) parseTextSitemap(sitemapURL, content string) []string {
+	urls := make([]string, 0)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "http://") && !strings.HasPrefix(line, "https://") {
+			continue
+		}
+		if len(urls) == config.SITEMAP_MAX_URLS {
+			log.Printf("\033[31m> Text sitemap %s lists more than %d URLs, only the first %d are used\033[0m", sitemapURL, config.SITEMAP_MAX_URLS, config.SITEMAP_MAX_URLS)
+			break
+		}
+		if ds.recordSitemapURL(models.SitemapURL{Loc: line}) {
+			urls = append(urls, line)
+		}
+	}
 	return urls
 }
 
+// recordsitemapurl keeps the lastmod date and priority of a valid sitemap url and reports whether it is valid
+func (ds *DiscoveryService) recordSitemapURL(url models.SitemapURL) bool {
+	if url.Loc == "" || !utils.IsValidURL(url.Loc, ds.baseURL, ds.policy) {
+		return false
+	}
+
+	key := utils.NormalizeURL(url.Loc, ds.policy)
+	if lastMod, ok := parseSitemapTime(url.LastMod); ok {
+		ds.lastModified[key] = lastMod
+	}
+	if priority, err := strconv.ParseFloat(strings.TrimSpace(url.Priority), 64); err == nil && priority >= 0 && priority <= 1 {
+		ds.priorities[key] = priority
+	}
+
+	return true
+}
+
+// parsesitemaptime parses a sitemap lastmod value in any of the w3c datetime forms
+func parseSitemapTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	layouts := []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05", "2006-01-02"}
+	for _, layout := range layouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// sitemaplastmod returns the lastmod date a sitemap listed for the url, if any
+func (ds *DiscoveryService) SitemapLastMod(url string) (time.Time, bool) {
+	lastMod, ok := ds.lastModified[utils.NormalizeURL(url, ds.policy)]
+	return lastMod, ok
+}
+
+// sitemappriority returns the priority a sitemap listed for the url, if any
+func (ds *DiscoveryService) SitemapPriority(url string) (float64, bool) {
+	priority, ok := ds.priorities[utils.NormalizeURL(url, ds.policy)]
+	return priority, ok
+}
+
+// haschanged sends a conditional head request for the url using the etag and last-modified values
+// of a previous capture, a 304 response or matching validators mean the page is unchanged, pages
+// without stored validators are always reported as changed
+func (ds *DiscoveryService) HasChanged(url, etag, lastModified string) (bool, error) {
+	if etag == "" && lastModified == "" {
+		return true, nil
+	}
+
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return true, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := ds.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	if etag != "" && resp.Header.Get("ETag") != "" {
+		return resp.Header.Get("ETag") != etag, nil
+	}
+	if lastModified != "" && resp.Header.Get("Last-Modified") != "" {
+		return resp.Header.Get("Last-Modified") != lastModified, nil
+	}
+
+	return true, nil
+}
+
 // testsitemapaccess tests if sitemap.xml is accessible
 func (ds *DiscoveryService) TestSitemapAccess() error {
 	sitemapURL := ds.baseURL + "/sitemap.xml"
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"framely/src/config"
+)
+
+// testfetchsitemapfollowsindexes serves a sitemap index that lists a gzipped sitemap, a text sitemap
+// and itself, and checks that every url is found once, the cycle ends and priorities are kept
+func TestFetchSitemapFollowsIndexes(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%[1]s/pages.xml.gz</loc></sitemap>
+	<sitemap><loc>%[1]s/posts.txt</loc></sitemap>
+	<sitemap><loc>%[1]s/sitemap.xml</loc></sitemap>
+</sitemapindex>`, server.URL)
+		case "/pages.xml.gz":
+			var buf bytes.Buffer
+			writer := gzip.NewWriter(&buf)
+			fmt.Fprintf(writer, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>%[1]s/about</loc><lastmod>2024-05-01</lastmod><priority>0.8</priority></url>
+	<url><loc> %[1]s/contact </loc></url>
+	<url><loc>https://elsewhere.example/page</loc></url>
+</urlset>`, server.URL)
+			writer.Close()
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(buf.Bytes())
+		case "/posts.txt":
+			fmt.Fprintf(w, "%[1]s/blog/first\n\n%[1]s/blog/second\nnot a url\n", server.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ds := NewDiscoveryService(server.URL, config.DEFAULT_USER_AGENT, config.DefaultURLPolicy())
+	urls := ds.fetchAndParseSitemap(server.URL + "/sitemap.xml")
+	sort.Strings(urls)
+
+	want := []string{server.URL + "/about", server.URL + "/blog/first", server.URL + "/blog/second", server.URL + "/contact"}
+	if fmt.Sprint(urls) != fmt.Sprint(want) {
+		t.Fatalf("urls = %v, want %v", urls, want)
+	}
+
+	if priority, ok := ds.SitemapPriority(server.URL + "/about"); !ok || priority != 0.8 {
+		t.Fatalf("priority = %v, %v, want 0.8", priority, ok)
+	}
+	if _, ok := ds.SitemapLastMod(server.URL + "/about"); !ok {
+		t.Fatal("lastmod of /about was not kept")
+	}
+}
+
+// testfetchrobotsstatus checks that a missing robots.txt allows everything while a server error
+// disallows everything, and that a server error is retried before giving up
+func TestFetchRobotsStatus(t *testing.T) {
+	tests := []struct {
+		status       int
+		wantAllowed  bool
+		wantRequests int
+	}{
+		{http.StatusNotFound, true, 1},
+		{http.StatusForbidden, true, 1},
+		{http.StatusInternalServerError, false, ROBOTS_FETCH_ATTEMPTS},
+		{http.StatusServiceUnavailable, false, ROBOTS_FETCH_ATTEMPTS},
+	}
+
+	for _, test := range tests {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(test.status)
+		}))
+
+		rules := NewDiscoveryService(server.URL, config.DEFAULT_USER_AGENT, config.DefaultURLPolicy()).loadRobots()
+		server.Close()
+
+		if got := rules.allowed(server.URL+"/page", ROBOTS_AGENT_TOKEN); got != test.wantAllowed {
+			t.Errorf("HTTP %d: allowed = %v, want %v", test.status, got, test.wantAllowed)
+		}
+		if requests != test.wantRequests {
+			t.Errorf("HTTP %d: requests = %d, want %d", test.status, requests, test.wantRequests)
+		}
+	}
+}
+
+// testfetchrobotsunreachable checks that a robots.txt that cannot be requested disallows everything
+func TestFetchRobotsUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	baseURL := server.URL
+	server.Close()
+
+	if NewDiscoveryService(baseURL, config.DEFAULT_USER_AGENT, config.DefaultURLPolicy()).loadRobots().allowed(baseURL+"/", ROBOTS_AGENT_TOKEN) {
+		t.Error("unreachable robots.txt allowed the crawl")
+	}
+}
+
+// testfetchrobotssendsuseragent checks that robots.txt is requested with the configured user agent,
+// so a server that turns away the default go client still serves the rules meant for the crawler
+func TestFetchRobotsSendsUserAgent(t *testing.T) {
+	const userAgent = "Framely-Test/1.0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != userAgent {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	defer server.Close()
+
+	rules := NewDiscoveryService(server.URL, userAgent, config.DefaultURLPolicy()).loadRobots()
+	if !rules.allowed(server.URL+"/", ROBOTS_AGENT_TOKEN) {
+		t.Error("robots.txt fetched with the configured user agent disallowed the crawl")
+	}
+	if rules.allowed(server.URL+"/private", ROBOTS_AGENT_TOKEN) {
+		t.Error("rules served for the configured user agent were not applied")
+	}
+}
@@ -3,13 +3,16 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"framely/src/config"
 	"framely/src/models"
+	"framely/src/utils"
 )
 
 // reportservice holds configuration and output directory for report operations
@@ -28,7 +31,12 @@ func NewReportService(cfg *config.Config) *ReportService {
 
 // loadexistingreport loads the existing report from the output directory
 func (rs *ReportService) LoadExistingReport() (*models.Report, error) {
-	reportPath := filepath.Join(rs.outputDir, config.REPORT_FILE)
+	return loadReport(rs.outputDir)
+}
+
+// loadreport loads the report stored in the given directory
+func loadReport(dir string) (*models.Report, error) {
+	reportPath := filepath.Join(dir, config.REPORT_FILE)
 
 	data, err := os.ReadFile(reportPath)
 	if err != nil {
@@ -45,31 +53,47 @@ func (rs *ReportService) LoadExistingReport() (*models.Report, error) {
 
 // generatereport generates a new report by combining existing and new results, calculates statistics, saves json and summary
 func (rs *ReportService) GenerateReport(session *models.CrawlSession, existingReport *models.Report) error {
-	var allResults []models.ScreenshotResult
+	sessionResults := session.GetResults()
 
+	var existingResults []models.ScreenshotResult
 	if existingReport != nil {
-		allResults = append(allResults, existingReport.Results...)
+		existingResults = existingReport.Results
 	}
 
-	sessionResults := session.GetResults()
-	allResults = append(allResults, sessionResults...)
+	policy := rs.config.URLPolicy()
+	allResults, newPages := mergeResults(existingResults, sessionResults, policy)
 
 	successCount := 0
 	failCount := 0
+	timedOutCount := 0
 	totalDuration := int64(0)
 	totalFileSize := int64(0)
 
+	deviceStats := make(map[string]models.DeviceStats)
+
 	for _, result := range allResults {
+		stats := deviceStats[result.Device]
+		stats.Total++
 		if result.Success {
 			successCount++
 			totalFileSize += result.FileSize
+			stats.SuccessfulScreenshots++
 		}
 		if !result.Success {
 			failCount++
+			stats.FailedScreenshots++
 		}
+		if !result.Success && result.TimedOut {
+			timedOutCount++
+		}
+		deviceStats[result.Device] = stats
 		totalDuration += result.Duration
 	}
 
+	if _, untagged := deviceStats[""]; untagged && len(deviceStats) == 1 {
+		deviceStats = nil
+	}
+
 	averagePageSize := int64(0)
 	if successCount > 0 {
 		averagePageSize = totalFileSize / int64(successCount)
@@ -81,16 +105,30 @@ func (rs *ReportService) GenerateReport(session *models.CrawlSession, existingRe
 		lastUpdate = &timestamp
 	}
 
+	stopReason := session.StopReason()
+	if stopReason == "" {
+		stopReason = STOP_REASON_COMPLETED
+	}
+
 	report := models.Report{
 		BaseURL:               rs.config.BaseURL,
-		TotalPages:            len(allResults),
+		ImageFormat:           rs.config.ImageFormat,
+		Interrupted:           stopReason == STOP_REASON_INTERRUPTED,
+		StopReason:            stopReason,
+		UnvisitedURLs:         session.UnvisitedURLs(),
+		Exclusions:            session.ExclusionCounts(),
+		URLPolicy:             &policy,
+		TotalPages:            countPages(allResults, policy),
+		TotalResults:          len(allResults),
 		SuccessfulScreenshots: successCount,
 		FailedScreenshots:     failCount,
+		TimedOutScreenshots:   timedOutCount,
 		Timestamp:             timestamp,
 		LastUpdate:            lastUpdate,
-		NewPagesInThisRun:     len(sessionResults),
+		NewPagesInThisRun:     newPages,
 		TotalDuration:         totalDuration,
 		AveragePageSize:       averagePageSize,
+		Devices:               deviceStats,
 		Results:               allResults,
 	}
 
@@ -105,6 +143,73 @@ func (rs *ReportService) GenerateReport(session *models.CrawlSession, existingRe
 	return nil
 }
 
+// mergeresults combines existing and new results into one result per url normalized with the policy and device,
+// the latest attempt wins and carries the attempts of every earlier one, it also returns how many
+// urls the new results added that were not in the existing ones on any device
+func mergeResults(existing, latest []models.ScreenshotResult, policy config.URLPolicy) ([]models.ScreenshotResult, int) {
+	var keys []string
+	merged := make(map[string]models.ScreenshotResult)
+
+	add := func(result models.ScreenshotResult) {
+		key := result.Key(policy)
+		previous, ok := merged[key]
+		if !ok {
+			result.Attempts = result.AttemptHistory()
+			merged[key] = result
+			keys = append(keys, key)
+			return
+		}
+
+		winner, loser := result, previous
+		if previous.Timestamp.After(result.Timestamp) {
+			winner, loser = previous, result
+		}
+
+		attempts := append(append([]models.Attempt{}, loser.AttemptHistory()...), winner.AttemptHistory()...)
+		sort.SliceStable(attempts, func(i, j int) bool {
+			return attempts[i].Timestamp.Before(attempts[j].Timestamp)
+		})
+		winner.Attempts = attempts
+
+		if len(winner.History) == 0 {
+			winner.History = loser.History
+		}
+
+		merged[key] = winner
+	}
+
+	existingPages := make(map[string]bool)
+	for _, result := range existing {
+		add(result)
+		existingPages[utils.NormalizeURL(result.URL, policy)] = true
+	}
+
+	newPages := make(map[string]bool)
+	for _, result := range latest {
+		add(result)
+		if page := utils.NormalizeURL(result.URL, policy); !existingPages[page] {
+			newPages[page] = true
+		}
+	}
+
+	results := make([]models.ScreenshotResult, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, merged[key])
+	}
+
+	return results, len(newPages)
+}
+
+// countpages returns the number of distinct urls normalized with the policy among the results, a page
+// captured on several devices counts once
+func countPages(results []models.ScreenshotResult, policy config.URLPolicy) int {
+	pages := make(map[string]bool)
+	for _, result := range results {
+		pages[utils.NormalizeURL(result.URL, policy)] = true
+	}
+	return len(pages)
+}
+
 // savejsonreport saves the report as json to the output directory
 func (rs *ReportService) saveJSONReport(report models.Report) error {
 	reportPath := filepath.Join(rs.outputDir, config.REPORT_FILE)
@@ -140,10 +245,22 @@ func (rs *ReportService) buildSummaryContent(report models.Report, newResults []
 
 	sb.WriteString(fmt.Sprintf("\033[36m> Site: %s\n\033[0m", report.BaseURL))
 	sb.WriteString(fmt.Sprintf("\033[36m> Generated: %s\n\033[0m", report.Timestamp.Format("2006-01-02 15:04:05")))
+	sb.WriteString(fmt.Sprintf("\033[36m> Image Format: %s\n\033[0m", strings.ToUpper(report.ImageFormat)))
 	sb.WriteString(fmt.Sprintf("\033[36m> Total Pages: %d\n\033[0m", report.TotalPages))
+	if len(report.Devices) > 0 {
+		sb.WriteString(fmt.Sprintf("\033[36m> Total Screenshots: %d across %d devices\n\033[0m", report.TotalResults, len(report.Devices)))
+	}
 	sb.WriteString(fmt.Sprintf("\033[32m> Successful: %d\n\033[0m", report.SuccessfulScreenshots))
 	sb.WriteString(fmt.Sprintf("\033[31m> Failed: %d\n\033[0m", report.FailedScreenshots))
+	if report.TimedOutScreenshots > 0 {
+		sb.WriteString(fmt.Sprintf("\033[33m> Timed out: %d\n\033[0m", report.TimedOutScreenshots))
+	}
 	sb.WriteString(fmt.Sprintf("\033[36m> New in this run: %d\n\033[0m", report.NewPagesInThisRun))
+	if report.Interrupted {
+		sb.WriteString(fmt.Sprintf("\033[33m> Interrupted: partial report, %d URLs left unvisited\n\033[0m", len(report.UnvisitedURLs)))
+	} else if report.StopReason != "" && report.StopReason != STOP_REASON_COMPLETED {
+		sb.WriteString(fmt.Sprintf("\033[33m> Stopped early: %s, %d URLs left unvisited\n\033[0m", report.StopReason, len(report.UnvisitedURLs)))
+	}
 	sb.WriteString(fmt.Sprintf("\033[36m> Total Duration: %.2f seconds\n\033[0m", float64(report.TotalDuration)/1000.0))
 	sb.WriteString(fmt.Sprintf("\033[36m> Average Page Size: %.2f KB\n\n\033[0m", float64(report.AveragePageSize)/1024.0))
 
@@ -161,45 +278,229 @@ func (rs *ReportService) buildSummaryContent(report models.Report, newResults []
 		sb.WriteString("\n")
 	}
 
-	sb.WriteString("\033[36m> All successful pages:\n\033[0m")
-	for _, result := range report.Results {
-		if result.Success {
-			sb.WriteString(fmt.Sprintf("\033[32m> SUCCESS %s -> %s (%.2fKB)\n\033[0m",
-				result.URL,
-				result.Filename,
-				float64(result.FileSize)/1024,
-			))
-		}
+	if len(report.Devices) == 0 {
+		sb.WriteString("\033[36m> All successful pages:\n\033[0m")
+		rs.writeSuccessfulResults(&sb, report.Results, "")
+	}
+
+	for _, device := range sortedDeviceNames(report.Devices) {
+		stats := report.Devices[device]
+		sb.WriteString(fmt.Sprintf("\033[36m> Successful pages on %s (%d/%d):\n\033[0m", deviceLabel(device), stats.SuccessfulScreenshots, stats.Total))
+		rs.writeSuccessfulResults(&sb, report.Results, device)
+		sb.WriteString("\n")
 	}
 
 	if report.FailedScreenshots > 0 {
 		sb.WriteString("\n\033[36m> Failed pages:\n\033[0m")
 		for _, result := range report.Results {
 			if !result.Success {
-				sb.WriteString(fmt.Sprintf("\033[31m> FAILED %s - %s\n\033[0m", result.URL, result.Error))
+				sb.WriteString(fmt.Sprintf("\033[31m> FAILED %s%s - %s%s%s\n\033[0m", result.URL, deviceSuffix(result.Device), errorClassPrefix(result.ErrorClass), result.Error, attemptsSuffix(result)))
 			}
 		}
 	}
 
+	if len(report.Exclusions) > 0 {
+		sb.WriteString("\n\033[36m> Excluded URLs by rule:\n\033[0m")
+		for _, rule := range sortedExclusionRules(report.Exclusions) {
+			sb.WriteString(fmt.Sprintf("\033[33m> %d %s\n\033[0m", report.Exclusions[rule], rule))
+		}
+	}
+
 	return sb.String()
 }
 
-// getexistingurls returns a map of existing urls from the report
-func (rs *ReportService) GetExistingURLs() (map[string]bool, error) {
-	existingURLs := make(map[string]bool)
+// sortedexclusionrules returns the rules that excluded urls, the rule that excluded the most urls first
+func sortedExclusionRules(exclusions map[string]int) []string {
+	rules := make([]string, 0, len(exclusions))
+	for rule := range exclusions {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if exclusions[rules[i]] != exclusions[rules[j]] {
+			return exclusions[rules[i]] > exclusions[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	return rules
+}
+
+// writesuccessfulresults writes one line per successful result, limited to the given device when there are several
+func (rs *ReportService) writeSuccessfulResults(sb *strings.Builder, results []models.ScreenshotResult, device string) {
+	for _, result := range results {
+		if result.Success && result.Device == device {
+			sb.WriteString(fmt.Sprintf("\033[32m> SUCCESS %s -> %s (%.2fKB)%s\n\033[0m",
+				result.URL,
+				result.Filename,
+				float64(result.FileSize)/1024,
+				statusSuffix(result.StatusCode),
+			))
+		}
+	}
+}
+
+// statussuffix returns the http status in brackets when a page answered with anything but 2xx
+func statusSuffix(statusCode int) string {
+	if statusCode == 0 || (statusCode >= 200 && statusCode <= 299) {
+		return ""
+	}
+	return fmt.Sprintf(" [HTTP %d]", statusCode)
+}
+
+// errorclassprefix returns the error class in brackets, or nothing for results without one
+func errorClassPrefix(class string) string {
+	if class == "" {
+		return ""
+	}
+	return "[" + class + "] "
+}
+
+// attemptssuffix returns the number of attempts in brackets for results that were tried more than once
+func attemptsSuffix(result models.ScreenshotResult) string {
+	if len(result.Attempts) < 2 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d attempts)", len(result.Attempts))
+}
+
+// devicesuffix returns a bracketed device name for tagged results and nothing for untagged ones
+func deviceSuffix(device string) string {
+	if device == "" {
+		return ""
+	}
+	return " [" + device + "]"
+}
+
+// sorteddevicenames returns the device names of the stats map in alphabetical order
+func sortedDeviceNames(devices map[string]models.DeviceStats) []string {
+	names := make([]string, 0, len(devices))
+	for name := range devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// devicelabel returns a printable name for a device, untagged results come from the default viewport
+func deviceLabel(device string) string {
+	if device == "" {
+		return config.DEFAULT_DEVICE_NAME
+	}
+	return device
+}
+
+// getexistingresults returns the results of the existing report whose latest attempt succeeded, grouped
+// by the url normalized with the current policy, a url has one result per device profile it was captured with
+func (rs *ReportService) GetExistingResults() (map[string][]models.ScreenshotResult, error) {
+	existingResults := make(map[string][]models.ScreenshotResult)
 
 	report, err := rs.LoadExistingReport()
 	if err != nil {
-		return existingURLs, nil
+		return existingResults, nil
 	}
 
-	for _, result := range report.Results {
+	policy := rs.config.URLPolicy()
+	if rekeyed, merged := rekeyResults(report, policy); rekeyed > 0 {
+		log.Printf("\033[33m> report.json was written with another URL policy, %d results were re-keyed and %d merged with a result of the same page\033[0m", rekeyed, merged)
+	}
+
+	results, _ := mergeResults(report.Results, nil, policy)
+	for _, result := range results {
 		if result.Success {
-			existingURLs[result.URL] = true
+			key := utils.NormalizeURL(result.URL, policy)
+			existingResults[key] = append(existingResults[key], result)
+		}
+	}
+
+	return existingResults, nil
+}
+
+// rekeyresults counts how the results of a report written with another url policy, or before the policy
+// was stored, pair under the given policy: results whose key changes and results that now share the key of
+// another result, the latest of which wins when the report is merged
+func rekeyResults(report *models.Report, policy config.URLPolicy) (int, int) {
+	previous := config.LegacyURLPolicy()
+	if report.URLPolicy != nil {
+		previous = *report.URLPolicy
+	}
+	if previous.Equal(policy) {
+		return 0, 0
+	}
+
+	rekeyed := 0
+	keys := make(map[string]bool)
+	for _, result := range report.Results {
+		key := result.Key(policy)
+		if key != result.Key(previous) {
+			rekeyed++
 		}
+		keys[key] = true
+	}
+
+	return rekeyed, len(report.Results) - len(keys)
+}
+
+// archivescreenshot moves a previous screenshot into the history directory, tagged with its capture time
+// down to the millisecond, and returns its new path relative to the output directory, a numbered suffix
+// keeps earlier versions when two captures share the same time
+func (rs *ReportService) ArchiveScreenshot(filename string, capturedAt time.Time) (string, error) {
+	historyDir := filepath.Join(rs.outputDir, config.HISTORY_DIR)
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create history directory: %w", err)
 	}
 
-	return existingURLs, nil
+	extension := filepath.Ext(filename)
+	stem := strings.TrimSuffix(filename, extension) + "_" + strings.Replace(capturedAt.Format(config.HISTORY_TIME_FORMAT), ".", "_", 1)
+	archived := filepath.Join(config.HISTORY_DIR, stem+extension)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(rs.outputDir, archived)); os.IsNotExist(err) {
+			break
+		}
+		archived = filepath.Join(config.HISTORY_DIR, fmt.Sprintf("%s_%d%s", stem, n, extension))
+	}
+
+	if err := os.Rename(filepath.Join(rs.outputDir, filename), filepath.Join(rs.outputDir, archived)); err != nil {
+		return "", err
+	}
+
+	return archived, nil
+}
+
+// writetempscreenshot writes screenshot data to a temporary file in the output directory and returns its path
+// and the written file size, the screenshot only replaces the current file once committed with commitscreenshot
+func (rs *ReportService) WriteTempScreenshot(filename string, data []byte) (string, int64, error) {
+	file, err := os.CreateTemp(rs.outputDir, "."+filename+".*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	tempPath := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return "", 0, err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return "", 0, err
+	}
+
+	fileInfo, err := os.Stat(tempPath)
+	if err != nil {
+		return tempPath, int64(len(data)), nil
+	}
+
+	return tempPath, fileInfo.Size(), nil
+}
+
+// commitscreenshot moves a temporary screenshot into place under its final name, the temporary file is
+// removed when the move fails
+func (rs *ReportService) CommitScreenshot(tempPath, filename string) error {
+	if err := os.Rename(tempPath, filepath.Join(rs.outputDir, filename)); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
 }
 
 // ensureoutputdirectory creates the output directory if it does not exist
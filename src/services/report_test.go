@@ -0,0 +1,191 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"framely/src/config"
+	"framely/src/models"
+)
+
+// testmergeresultslatestattemptwins merges a failed run with a retry and checks that each url and device
+// appears once, keeps the newest result and counts only pages the retry added
+func TestMergeResultsLatestAttemptWins(t *testing.T) {
+	first := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	existing := []models.ScreenshotResult{
+		{URL: "https://example.com/about", Success: false, Error: "timeout", Timestamp: first},
+		{URL: "https://example.com/", Success: true, Filename: "index.png", Timestamp: first},
+		{URL: "https://example.com/", Device: "iphone", Success: true, Filename: "index__iphone.png", Timestamp: first},
+	}
+	latest := []models.ScreenshotResult{
+		{URL: "https://example.com/about/", Success: true, Filename: "about.png", Timestamp: second},
+		{URL: "https://example.com/contact", Success: false, Error: "timeout", Timestamp: second},
+	}
+
+	results, newPages := mergeResults(existing, latest, config.DefaultURLPolicy())
+
+	if len(results) != 4 {
+		t.Fatalf("merged %d results, want 4", len(results))
+	}
+	if newPages != 1 {
+		t.Fatalf("new pages = %d, want 1", newPages)
+	}
+
+	about := results[0]
+	if !about.Success || about.Filename != "about.png" {
+		t.Fatalf("about result = %+v, want the successful retry", about)
+	}
+	if len(about.Attempts) != 2 || about.Attempts[0].Success || !about.Attempts[1].Success {
+		t.Fatalf("about attempts = %+v, want the failure followed by the success", about.Attempts)
+	}
+
+	reversed, _ := mergeResults(latest[:1], existing[:1], config.DefaultURLPolicy())
+	if !reversed[0].Success {
+		t.Fatal("an older failure replaced a newer success")
+	}
+}
+
+// testtempscreenshotreplacesonlyoncommit checks that a staged screenshot leaves the current file in place
+// until it is committed, and that no temporary file is left behind
+func TestTempScreenshotReplacesOnlyOnCommit(t *testing.T) {
+	dir := t.TempDir()
+	rs := &ReportService{outputDir: dir}
+	path := filepath.Join(dir, "about.png")
+
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tempPath, size, err := rs.WriteTempScreenshot("about.png", []byte("new image"))
+	if err != nil {
+		t.Fatalf("WriteTempScreenshot error: %v", err)
+	}
+	if size != int64(len("new image")) {
+		t.Fatalf("size = %d, want %d", size, len("new image"))
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Fatalf("current file = %q before commit, want old", data)
+	}
+
+	if err := rs.CommitScreenshot(tempPath, "about.png"); err != nil {
+		t.Fatalf("CommitScreenshot error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new image" {
+		t.Fatalf("current file = %q after commit, want the new image", data)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("output directory has %d entries, want only the screenshot", len(entries))
+	}
+}
+
+// testarchivescreenshotkeepseveryversion checks that archived names carry milliseconds and that two
+// versions captured at the same time are both kept
+func TestArchiveScreenshotKeepsEveryVersion(t *testing.T) {
+	dir := t.TempDir()
+	rs := &ReportService{outputDir: dir}
+	capturedAt := time.Date(2024, 1, 1, 10, 0, 0, 123456789, time.UTC)
+
+	var archived []string
+	for _, content := range []string{"first", "second"} {
+		if err := os.WriteFile(filepath.Join(dir, "about.png"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		path, err := rs.ArchiveScreenshot("about.png", capturedAt)
+		if err != nil {
+			t.Fatalf("ArchiveScreenshot error: %v", err)
+		}
+		archived = append(archived, path)
+	}
+
+	want := []string{
+		filepath.Join(config.HISTORY_DIR, "about_20240101_100000_123.png"),
+		filepath.Join(config.HISTORY_DIR, "about_20240101_100000_123_2.png"),
+	}
+	for i, path := range archived {
+		if path != want[i] {
+			t.Errorf("archived path %d = %s, want %s", i, path, want[i])
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, want[0])); string(data) != "first" {
+		t.Errorf("first version = %q, want first", data)
+	}
+}
+
+// testmergeresultscountspagesonceperurl checks that a page captured on several devices counts as one page,
+// and that adding a device to a known page does not count as a new page
+func TestMergeResultsCountsPagesOncePerURL(t *testing.T) {
+	existing := []models.ScreenshotResult{
+		{URL: "https://example.com/", Success: true},
+	}
+	latest := []models.ScreenshotResult{
+		{URL: "https://example.com/", Device: "iphone", Success: true},
+		{URL: "https://example.com/about", Success: true},
+		{URL: "https://example.com/about", Device: "iphone", Success: true},
+		{URL: "https://example.com/about", Device: "tablet", Success: false},
+	}
+
+	results, newPages := mergeResults(existing, latest, config.DefaultURLPolicy())
+
+	if len(results) != 5 {
+		t.Fatalf("merged %d results, want 5", len(results))
+	}
+	if pages := countPages(results, config.DefaultURLPolicy()); pages != 2 {
+		t.Fatalf("pages = %d, want 2", pages)
+	}
+	if newPages != 1 {
+		t.Fatalf("new pages = %d, want only the about page", newPages)
+	}
+}
+
+// testgetexistingresultsrekeysoldreport loads a report written before the url policy was stored and
+// checks that its results are keyed and merged under the current policy, and that a report written
+// with the current policy is left as it is
+func TestGetExistingResultsRekeysOldReport(t *testing.T) {
+	first := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	report := &models.Report{
+		Results: []models.ScreenshotResult{
+			{URL: "https://Example.com/docs/index.html", Success: true, Filename: "old.png", Timestamp: first},
+			{URL: "https://example.com/docs", Success: true, Filename: "docs.png", Timestamp: first.Add(time.Hour)},
+			{URL: "https://example.com/products", Success: true, Filename: "products.png", Timestamp: first},
+		},
+	}
+
+	cfg := config.NewConfig("https://example.com")
+	cfg.OutputDir = t.TempDir()
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, config.REPORT_FILE), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err := NewReportService(cfg).GetExistingResults()
+	if err != nil {
+		t.Fatalf("GetExistingResults error: %v", err)
+	}
+	docs := existing["https://example.com/docs"]
+	if len(existing) != 2 || len(docs) != 1 || docs[0].Filename != "docs.png" {
+		t.Fatalf("existing results = %+v, want the latest docs result and products", existing)
+	}
+
+	if rekeyed, merged := rekeyResults(report, cfg.URLPolicy()); rekeyed != 1 || merged != 1 {
+		t.Fatalf("rekeyed, merged = %d, %d, want 1, 1", rekeyed, merged)
+	}
+
+	policy := cfg.URLPolicy()
+	report.URLPolicy = &policy
+	if rekeyed, merged := rekeyResults(report, cfg.URLPolicy()); rekeyed != 0 || merged != 0 {
+		t.Fatalf("report with the current policy: rekeyed, merged = %d, %d, want 0, 0", rekeyed, merged)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	ERROR_CLASS_DNS                = "dns"
+	ERROR_CLASS_TLS                = "tls"
+	ERROR_CLASS_TIMEOUT            = "timeout"
+	ERROR_CLASS_NETWORK            = "network"
+	ERROR_CLASS_HTTP_4XX           = "http_4xx"
+	ERROR_CLASS_HTTP_5XX           = "http_5xx"
+	ERROR_CLASS_NAVIGATION_ABORTED = "navigation_aborted"
+	ERROR_CLASS_WRITE              = "write_error"
+	ERROR_CLASS_OTHER              = "other"
+)
+
+// errorclasspatterns maps chrome net error codes to an error class, checked in order
+var errorClassPatterns = []struct {
+	class    string
+	patterns []string
+}{
+	{ERROR_CLASS_DNS, []string{"ERR_NAME_NOT_RESOLVED", "ERR_NAME_RESOLUTION_FAILED", "ERR_DNS_"}},
+	{ERROR_CLASS_TLS, []string{"ERR_CERT_", "ERR_SSL_", "ERR_BAD_SSL_", "ERR_TLS_"}},
+	{ERROR_CLASS_TIMEOUT, []string{"ERR_TIMED_OUT", "ERR_CONNECTION_TIMED_OUT"}},
+	{ERROR_CLASS_NAVIGATION_ABORTED, []string{"ERR_ABORTED"}},
+	{ERROR_CLASS_NETWORK, []string{"ERR_CONNECTION_", "ERR_EMPTY_RESPONSE", "ERR_INTERNET_DISCONNECTED", "ERR_NETWORK_CHANGED", "ERR_ADDRESS_UNREACHABLE"}},
+}
+
+// classifyerror sorts a capture error into a class, chrome net errors and timeouts are recognised first,
+// other errors on a page that answered with a 4xx or 5xx status are attributed to that status
+func classifyError(err error, statusCode int) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, chromedp.ErrPollingTimeout) {
+		return ERROR_CLASS_TIMEOUT
+	}
+
+	message := err.Error()
+	for _, entry := range errorClassPatterns {
+		for _, pattern := range entry.patterns {
+			if strings.Contains(message, pattern) {
+				return entry.class
+			}
+		}
+	}
+
+	switch {
+	case statusCode >= 500:
+		return ERROR_CLASS_HTTP_5XX
+	case statusCode >= 400:
+		return ERROR_CLASS_HTTP_4XX
+	}
+
+	return ERROR_CLASS_OTHER
+}
+
+// istransienterror reports whether an error class is worth retrying, dns, tls, 4xx and write errors
+// will fail the same way again
+func isTransientError(class string) bool {
+	switch class {
+	case ERROR_CLASS_TIMEOUT, ERROR_CLASS_NETWORK, ERROR_CLASS_HTTP_5XX, ERROR_CLASS_NAVIGATION_ABORTED:
+		return true
+	default:
+		return false
+	}
+}
+
+// retrydelay returns the wait before the given retry, the base delay doubles with every retry up to the
+// maximum, and half of it is randomised so parallel workers do not retry in lockstep
+func retryDelay(retry int, base, maximum time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < retry && delay < maximum; i++ {
+		delay *= 2
+	}
+	if delay > maximum {
+		delay = maximum
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testclassifyerror checks the class assigned to typical chrome navigation errors
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err        error
+		statusCode int
+		want       string
+	}{
+		{nil, 0, ""},
+		{errors.New("page load error net::ERR_NAME_NOT_RESOLVED"), 0, ERROR_CLASS_DNS},
+		{errors.New("page load error net::ERR_CERT_AUTHORITY_INVALID"), 0, ERROR_CLASS_TLS},
+		{errors.New("page load error net::ERR_CONNECTION_TIMED_OUT"), 0, ERROR_CLASS_TIMEOUT},
+		{fmt.Errorf("capture: %w", context.DeadlineExceeded), 0, ERROR_CLASS_TIMEOUT},
+		{errors.New("page load error net::ERR_ABORTED"), 0, ERROR_CLASS_NAVIGATION_ABORTED},
+		{errors.New("page load error net::ERR_CONNECTION_RESET"), 0, ERROR_CLASS_NETWORK},
+		{errors.New("no visible element matches selector"), 503, ERROR_CLASS_HTTP_5XX},
+		{errors.New("no visible element matches selector"), 404, ERROR_CLASS_HTTP_4XX},
+		{errors.New("no visible element matches selector"), 200, ERROR_CLASS_OTHER},
+	}
+
+	for _, test := range tests {
+		if got := classifyError(test.err, test.statusCode); got != test.want {
+			t.Errorf("classifyError(%v, %d) = %q, want %q", test.err, test.statusCode, got, test.want)
+		}
+	}
+}
+
+// testretrydelay checks that the delay grows exponentially, stays within its jitter range and is capped
+func TestRetryDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	maximum := time.Second
+
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 6: time.Second} {
+		for i := 0; i < 100; i++ {
+			delay := retryDelay(retry, base, maximum)
+			if delay < want/2 || delay > want {
+				t.Fatalf("retryDelay(%d) = %s, want between %s and %s", retry, delay, want/2, want)
+			}
+		}
+	}
+
+	if delay := retryDelay(3, 0, maximum); delay != 0 {
+		t.Fatalf("retryDelay with zero base = %s, want 0", delay)
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ROBOTS_AGENT_TOKEN    = "framely"
+	ROBOTS_FETCH_ATTEMPTS = 2
+	ROBOTS_RETRY_DELAY    = time.Second
+)
+
+// robotsrule is one allow or disallow line of a robots.txt group
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsgroup holds the rules and crawl delay that apply to a set of user agents
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsrules is a parsed robots.txt file, disallowall is set when robots.txt could not be fetched
+// because of a server or network error, which per rfc 9309 means nothing may be crawled
+type robotsRules struct {
+	groups      []*robotsGroup
+	sitemaps    []string
+	disallowAll bool
+}
+
+// parserobots parses robots.txt content into user-agent groups, consecutive user-agent lines share
+// one group, comments and unknown fields are ignored, sitemap lines apply to the whole file
+func parseRobots(content string) *robotsRules {
+	rules := &robotsRules{}
+	var group *robotsGroup
+	groupHasRules := false
+
+	for _, line := range strings.Split(content, "\n") {
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+
+		field, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			if group == nil || groupHasRules {
+				group = &robotsGroup{}
+				rules.groups = append(rules.groups, group)
+				groupHasRules = false
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if group == nil {
+				continue
+			}
+			groupHasRules = true
+			if value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: field == "allow", pattern: value})
+		case "crawl-delay":
+			if group == nil {
+				continue
+			}
+			groupHasRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			if strings.HasPrefix(value, "http") {
+				rules.sitemaps = append(rules.sitemaps, value)
+			}
+		}
+	}
+
+	return rules
+}
+
+// groupsfor returns the groups that name the agent token, compared case-insensitively and ignoring a
+// version such as framely/1.0, the * groups are used when no group names the token, framely only
+// answers to its own token and never to the product names of the browser user agent
+func (rr *robotsRules) groupsFor(agent string) []*robotsGroup {
+	agent = strings.ToLower(agent)
+
+	var matched []*robotsGroup
+	var wildcard []*robotsGroup
+
+	for _, group := range rr.groups {
+		names, wild := false, false
+		for _, name := range group.agents {
+			name, _, _ = strings.Cut(name, "/")
+			names = names || name == agent
+			wild = wild || name == "*"
+		}
+		if names {
+			matched = append(matched, group)
+		} else if wild {
+			wildcard = append(wildcard, group)
+		}
+	}
+
+	if len(matched) > 0 {
+		return matched
+	}
+	return wildcard
+}
+
+// allowed reports whether the agent token may fetch the url, the longest matching rule decides and
+// allow wins a tie, urls without a matching rule are allowed unless robots.txt was unreachable
+func (rr *robotsRules) allowed(rawURL, agent string) bool {
+	if rr.disallowAll {
+		return false
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allowed := true
+	longest := -1
+	for _, group := range rr.groupsFor(agent) {
+		for _, rule := range group.rules {
+			if !robotsPatternMatches(rule.pattern, target) {
+				continue
+			}
+			if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+				longest = len(rule.pattern)
+				allowed = rule.allow
+			}
+		}
+	}
+
+	return allowed
+}
+
+// crawldelay returns the largest crawl delay of the groups that apply to the agent token
+func (rr *robotsRules) crawlDelay(agent string) time.Duration {
+	var delay time.Duration
+	for _, group := range rr.groupsFor(agent) {
+		if group.crawlDelay > delay {
+			delay = group.crawlDelay
+		}
+	}
+	return delay
+}
+
+// robotspatternmatches matches a robots.txt path pattern against a path and query, * matches any
+// sequence of characters and a trailing $ anchors the pattern to the end of the path
+func robotsPatternMatches(pattern, target string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(target, parts[0]) {
+		return false
+	}
+	position := len(parts[0])
+
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(target[position:], part)
+		}
+		index := strings.Index(target[position:], part)
+		if index < 0 {
+			return false
+		}
+		position += index + len(part)
+	}
+
+	return !anchored || position == len(target)
+}
+
+// crawlthrottle spaces out page loads across all workers so that consecutive loads start at least
+// the given interval apart
+type crawlThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next page load may start or ctx is done
+func (ct *crawlThrottle) wait(ctx context.Context) error {
+	ct.mu.Lock()
+	now := time.Now()
+	start := ct.next
+	if start.Before(now) {
+		start = now
+	}
+	ct.next = start.Add(ct.interval)
+	ct.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(start)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
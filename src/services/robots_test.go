@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 2
+
+User-agent: somebot
+User-agent: otherbot
+Disallow: /drafts
+Allow: /drafts/published$
+Crawl-delay: 0.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+// testrobotsallowed checks group selection, longest match precedence, wildcards and end anchors
+func TestRobotsAllowed(t *testing.T) {
+	rules := parseRobots(testRobots)
+	browser := "Mozilla/5.0 (X11; Linux x86_64) Chrome/121.0.0.0"
+
+	tests := []struct {
+		url       string
+		userAgent string
+		want      bool
+	}{
+		{"https://example.com/", browser, true},
+		{"https://example.com/private/page", browser, false},
+		{"https://example.com/private/public/page", browser, true},
+		{"https://example.com/files/report.pdf", browser, false},
+		{"https://example.com/files/report.pdf.html", browser, true},
+		{"https://example.com/search?q=test", browser, false},
+		{"https://example.com/search", browser, true},
+		{"https://example.com/private/page", "OtherBot", true},
+		{"https://example.com/drafts/new", "OtherBot", false},
+		{"https://example.com/drafts/published", "OtherBot", true},
+		{"https://example.com/drafts/published/2", "OtherBot", false},
+	}
+
+	for _, test := range tests {
+		if got := rules.allowed(test.url, test.userAgent); got != test.want {
+			t.Errorf("allowed(%q, %q) = %v, want %v", test.url, test.userAgent, got, test.want)
+		}
+	}
+
+	if delay := rules.crawlDelay(browser); delay != 2*time.Second {
+		t.Errorf("crawl delay = %s, want 2s", delay)
+	}
+	if delay := rules.crawlDelay("OtherBot"); delay != 500*time.Millisecond {
+		t.Errorf("crawl delay = %s, want 500ms", delay)
+	}
+	if parseRobots("User-agent: framely\nDisallow: /\n").allowed("https://example.com/", ROBOTS_AGENT_TOKEN) {
+		t.Error("group for the framely token did not apply")
+	}
+	if len(rules.sitemaps) != 1 {
+		t.Errorf("sitemaps = %v, want one", rules.sitemaps)
+	}
+}
+
+// testrobotsmatchesowntoken checks that only groups naming the crawler's own token apply to it,
+// case-insensitively and ignoring a version, and that groups for browsers are never picked up
+func TestRobotsMatchesOwnToken(t *testing.T) {
+	tests := []struct {
+		robots string
+		want   bool
+	}{
+		{"User-agent: Mozilla\nDisallow: /\n", true},
+		{"User-agent: Chrome/121\nDisallow: /\n", true},
+		{"User-agent: Framely/2.0\nDisallow: /\n", false},
+		{"User-agent: FRAMELY\nDisallow: /\n", false},
+		{"User-agent: framely-preview\nDisallow: /\n", true},
+		{"User-agent: Chrome\nAllow: /\n\nUser-agent: *\nDisallow: /\n", false},
+	}
+
+	for _, test := range tests {
+		if got := parseRobots(test.robots).allowed("https://example.com/", ROBOTS_AGENT_TOKEN); got != test.want {
+			t.Errorf("allowed with %q = %v, want %v", test.robots, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+)
+
+// browsertab is a single chromedp target checked out by one capture at a time
+type browserTab struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	pages    int
+	crashed  atomic.Bool
+	timedOut atomic.Bool
+}
+
+// tabpool hands out one tab per worker, a slot holds nil until its tab is opened, and tabs that crashed,
+// timed out or served recycleafter pages are closed and their slot emptied so the next checkout opens a new one
+type tabPool struct {
+	slots        chan *browserTab
+	recycleAfter int
+	open         func() (*browserTab, error)
+}
+
+// newtabpool creates a pool with the given number of empty slots, at least one, that opens tabs with open
+func newTabPool(size, recycleAfter int, open func() (*browserTab, error)) *tabPool {
+	if size < 1 {
+		size = 1
+	}
+
+	slots := make(chan *browserTab, size)
+	for i := 0; i < size; i++ {
+		slots <- nil
+	}
+
+	return &tabPool{slots: slots, recycleAfter: recycleAfter, open: open}
+}
+
+// acquire checks out a tab from the pool, blocking while every tab is in use,
+// empty slots left by recycled or crashed tabs are filled with a fresh tab
+func (tp *tabPool) acquire() (*browserTab, error) {
+	tab := <-tp.slots
+	if tab != nil {
+		return tab, nil
+	}
+
+	tab, err := tp.open()
+	if err != nil {
+		tp.slots <- nil
+		return nil, err
+	}
+
+	return tab, nil
+}
+
+// release returns a tab to the pool, closing it instead when it crashed or has served
+// the configured number of pages, so the next checkout gets a fresh target
+func (tp *tabPool) release(tab *browserTab) {
+	tab.pages++
+
+	if tab.crashed.Load() || tab.ctx.Err() != nil {
+		log.Printf("\033[31m> Browser tab crashed, replacing it\033[0m")
+		tab.cancel()
+		tp.slots <- nil
+		return
+	}
+
+	if tab.timedOut.Load() {
+		log.Printf("\033[33m> Browser tab timed out, replacing it\033[0m")
+		tab.cancel()
+		tp.slots <- nil
+		return
+	}
+
+	if tp.recycleAfter > 0 && tab.pages >= tp.recycleAfter {
+		log.Printf("\033[36m> Recycling browser tab after %d pages\033[0m", tab.pages)
+		tab.cancel()
+		tp.slots <- nil
+		return
+	}
+
+	tp.slots <- tab
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testtabopener returns an open function that creates tabs without a browser and the list of tabs it opened
+func testTabOpener() (func() (*browserTab, error), *[]*browserTab) {
+	opened := make([]*browserTab, 0)
+	open := func() (*browserTab, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		tab := &browserTab{ctx: ctx, cancel: cancel}
+		opened = append(opened, tab)
+		return tab, nil
+	}
+	return open, &opened
+}
+
+// testtabpoolrecyclesafterpages checks that a tab is reused until it has served the configured number
+// of pages and is then closed and replaced by a new one
+func TestTabPoolRecyclesAfterPages(t *testing.T) {
+	open, opened := testTabOpener()
+	pool := newTabPool(1, 2, open)
+
+	for i := 0; i < 5; i++ {
+		tab, err := pool.acquire()
+		if err != nil {
+			t.Fatalf("acquire %d error: %v", i, err)
+		}
+		pool.release(tab)
+	}
+
+	if len(*opened) != 3 {
+		t.Fatalf("opened %d tabs for 5 pages, want 3", len(*opened))
+	}
+	for i, tab := range (*opened)[:2] {
+		if tab.ctx.Err() == nil {
+			t.Errorf("recycled tab %d was not closed", i)
+		}
+	}
+	if (*opened)[2].ctx.Err() != nil {
+		t.Error("tab in use was closed")
+	}
+}
+
+// testtabpoolreplacesbrokentabs checks that crashed, closed and timed out tabs are replaced on the next checkout
+func TestTabPoolReplacesBrokenTabs(t *testing.T) {
+	breaks := map[string]func(tab *browserTab){
+		"crashed":   func(tab *browserTab) { tab.crashed.Store(true) },
+		"closed":    func(tab *browserTab) { tab.cancel() },
+		"timed out": func(tab *browserTab) { tab.timedOut.Store(true) },
+	}
+
+	for name, breakTab := range breaks {
+		t.Run(name, func(t *testing.T) {
+			open, opened := testTabOpener()
+			pool := newTabPool(1, 0, open)
+
+			tab, _ := pool.acquire()
+			breakTab(tab)
+			pool.release(tab)
+
+			next, err := pool.acquire()
+			if err != nil {
+				t.Fatalf("acquire error: %v", err)
+			}
+			if next == tab || len(*opened) != 2 {
+				t.Fatalf("broken tab was handed out again, opened %d tabs", len(*opened))
+			}
+			if tab.ctx.Err() == nil {
+				t.Fatal("broken tab was not closed")
+			}
+		})
+	}
+}
+
+// testtabpoolkeepsslotwhenopenfails checks that a failed open gives the slot back so a later checkout retries
+func TestTabPoolKeepsSlotWhenOpenFails(t *testing.T) {
+	fail := true
+	open, opened := testTabOpener()
+	pool := newTabPool(1, 0, func() (*browserTab, error) {
+		if fail {
+			return nil, errors.New("tab creation failed")
+		}
+		return open()
+	})
+
+	if _, err := pool.acquire(); err == nil {
+		t.Fatal("acquire succeeded although opening the tab failed")
+	}
+
+	fail = false
+	if _, err := pool.acquire(); err != nil || len(*opened) != 1 {
+		t.Fatalf("retry acquire = %v with %d tabs opened, want one new tab", err, len(*opened))
+	}
+}
+
+// testtabpoolsize checks that the pool has one slot per worker and at least one
+func TestTabPoolSize(t *testing.T) {
+	open, _ := testTabOpener()
+	if size := cap(newTabPool(4, 0, open).slots); size != 4 {
+		t.Errorf("pool size = %d, want 4", size)
+	}
+	if size := cap(newTabPool(0, 0, open).slots); size != 1 {
+		t.Errorf("pool size = %d, want 1", size)
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"framely/src/config"
+)
+
+const NOT_INCLUDED_RULE = "include: no rule matched"
+
+// urlfilter decides which urls are crawled, skip patterns and exclude rules take precedence over include rules,
+// when include rules are given a url must match at least one of them, the start url is exempt from include rules
+// so its links can still be followed
+type URLFilter struct {
+	baseURL      string
+	policy       config.URLPolicy
+	include      []compiledRule
+	exclude      []compiledRule
+	skipPatterns []string
+}
+
+// compiledrule is a url rule with its compiled pattern
+type compiledRule struct {
+	rule    config.URLRule
+	pattern *regexp.Regexp
+}
+
+// newurlfilter compiles the include and exclude rules into a filter for urls of the given start url,
+// urls are normalized with the policy before rules are matched
+func NewURLFilter(baseURL string, policy config.URLPolicy, include, exclude []config.URLRule, skipPatterns []string) (*URLFilter, error) {
+	filter := &URLFilter{
+		baseURL:      NormalizeURL(baseURL, policy),
+		policy:       policy,
+		skipPatterns: skipPatterns,
+	}
+
+	var err error
+	if filter.include, err = compileRules("include", include); err != nil {
+		return nil, err
+	}
+	if filter.exclude, err = compileRules("exclude", exclude); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// compilerules compiles every rule of a list, errors name the list and the position of the rule
+func compileRules(name string, rules []config.URLRule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		pattern, err := rule.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("%s rule %d: %w", name, i+1, err)
+		}
+		compiled = append(compiled, compiledRule{rule: rule, pattern: pattern})
+	}
+	return compiled, nil
+}
+
+// excludedby returns the rule that keeps the url from being crawled, e.g. exclude: regex:path:/print$,
+// or an empty string when the url is crawled, rules are matched against the normalized url
+func (f *URLFilter) ExcludedBy(urlStr string) string {
+	if f == nil {
+		return ""
+	}
+
+	for _, pattern := range f.skipPatterns {
+		if ShouldSkipURL(urlStr, []string{pattern}) {
+			return "skip: " + pattern
+		}
+	}
+
+	normalized := NormalizeURL(urlStr, f.policy)
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return ""
+	}
+
+	for _, rule := range f.exclude {
+		if rule.pattern.MatchString(rule.rule.Target(u.Path, u.RawQuery, normalized)) {
+			return "exclude: " + rule.rule.String()
+		}
+	}
+
+	if len(f.include) == 0 || normalized == f.baseURL {
+		return ""
+	}
+
+	for _, rule := range f.include {
+		if rule.pattern.MatchString(rule.rule.Target(u.Path, u.RawQuery, normalized)) {
+			return ""
+		}
+	}
+
+	return NOT_INCLUDED_RULE
+}
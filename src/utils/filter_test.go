@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+
+	"framely/src/config"
+)
+
+// testurlfilterprecedence checks that skip patterns and exclude rules win over include rules, that urls
+// outside the include rules are rejected and that the start url is always crawled
+func TestURLFilterPrecedence(t *testing.T) {
+	var include, exclude []config.URLRule
+	for _, value := range []string{"/docs/**", "regex:query:(^|&)lang=en(&|$)"} {
+		rule, err := config.ParseURLRule(value)
+		if err != nil {
+			t.Fatalf("ParseURLRule(%q) error: %v", value, err)
+		}
+		include = append(include, rule)
+	}
+	rule, err := config.ParseURLRule("regex:/print$")
+	if err != nil {
+		t.Fatalf("ParseURLRule error: %v", err)
+	}
+	exclude = append(exclude, rule)
+
+	filter, err := NewURLFilter("https://example.com", config.DefaultURLPolicy(), include, exclude, []string{"/wp-admin"})
+	if err != nil {
+		t.Fatalf("NewURLFilter error: %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/", ""},
+		{"https://example.com/docs", ""},
+		{"https://example.com/docs/guide/install/", ""},
+		{"https://example.com/blog?lang=en", ""},
+		{"https://example.com/docs/guide/print", "exclude: regex:path:/print$"},
+		{"https://example.com/docs/wp-admin", "skip: /wp-admin"},
+		{"https://example.com/blog", NOT_INCLUDED_RULE},
+		{"https://example.com/documents", NOT_INCLUDED_RULE},
+	}
+
+	for _, test := range tests {
+		if got := filter.ExcludedBy(test.url); got != test.want {
+			t.Errorf("ExcludedBy(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+// testparseurlruleerrors checks that invalid rules are rejected when they are parsed
+func TestParseURLRuleErrors(t *testing.T) {
+	for _, value := range []string{"", "regex:(", "regex:query:"} {
+		if _, err := config.ParseURLRule(value); err == nil {
+			t.Errorf("ParseURLRule(%q) succeeded, want an error", value)
+		}
+	}
+}
@@ -2,25 +2,27 @@ package utils
 
 import (
 	"net/url"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"framely/src/config"
 )
 
-// isvalidurl checks if the given url is valid, it parses the url, compares host and scheme with baseurl, checks for excluded extensions, excludes mailto, tel, javascript protocols
-func IsValidURL(urlStr, baseURL string) bool {
+// isvalidurl checks if the given url is valid, it parses the url normalized with the policy, compares host and scheme with baseurl, checks for excluded extensions, excludes mailto, tel, javascript protocols
+func IsValidURL(urlStr, baseURL string, policy config.URLPolicy) bool {
 	if urlStr == "" {
 		return false
 	}
 
-	u, err := url.Parse(urlStr)
+	u, err := url.Parse(NormalizeURL(urlStr, policy))
 	if err != nil {
 		return false
 	}
 
-	baseU, err := url.Parse(baseURL)
+	baseU, err := url.Parse(NormalizeURL(baseURL, policy))
 	if err != nil {
 		return false
 	}
@@ -43,18 +45,37 @@ func IsValidURL(urlStr, baseURL string) bool {
 	return true
 }
 
-// normalizeurl normalizes the url by removing fragment and query, setting path to / if empty, trimming trailing slash
-func NormalizeURL(urlStr string) string {
+// normalizeurl normalizes the url with the given policy by removing the fragment, filtering and optionally sorting the query,
+// lowercasing the host, stripping default ports, dropping index files and trimming the trailing slash,
+// so every url of the same page maps to the same string
+func NormalizeURL(urlStr string, policy config.URLPolicy) string {
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		return urlStr
 	}
 
 	u.Fragment = ""
-	u.RawQuery = ""
+	u.RawFragment = ""
+	u.RawQuery = normalizeQuery(u.RawQuery, policy)
+	u.ForceQuery = false
 
-	if u.Path == "" {
-		u.Path = "/"
+	if policy.LowercaseHost {
+		u.Host = strings.ToLower(u.Host)
+	}
+
+	if policy.StripDefaultPort {
+		port := u.Port()
+		if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+			u.Host = strings.TrimSuffix(u.Host, ":"+port)
+		}
+	}
+
+	dir, file := path.Split(u.Path)
+	for _, index := range policy.IndexFiles {
+		if strings.EqualFold(file, index) {
+			u.Path = dir
+			break
+		}
 	}
 
 	u.Path = strings.TrimSuffix(u.Path, "/")
@@ -65,6 +86,41 @@ func NormalizeURL(urlStr string) string {
 	return u.String()
 }
 
+// normalizequery drops the query parameters the policy ignores and sorts the rest by name when asked,
+// parameters keep their original encoding
+func normalizeQuery(rawQuery string, policy config.URLPolicy) string {
+	if policy.StripQuery || rawQuery == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0)
+	names := make(map[string]string)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+
+		rawName, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+
+		if policy.KeepsQueryParam(name) {
+			pairs = append(pairs, pair)
+			names[pair] = name
+		}
+	}
+
+	if policy.SortQuery {
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return names[pairs[i]] < names[pairs[j]]
+		})
+	}
+
+	return strings.Join(pairs, "&")
+}
+
 // fixrelativeurl fixes relative urls by resolving them against the baseurl, if already absolute, returns as is
 func FixRelativeURL(link, baseURL string) string {
 	if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
@@ -95,11 +151,12 @@ func ShouldSkipURL(urlStr string, skipPatterns []string) bool {
 	return false
 }
 
-// generatefilename generates a filename from the url, replaces path slashes with underscores, adds query if present, sanitizes, appends .png
-func GenerateFilename(urlStr string) string {
-	u, err := url.Parse(urlStr)
+// generatefilename generates a filename from the url normalized with the policy, replaces path slashes with underscores, adds query if present,
+// adds the device profile name if given, sanitizes, appends the image extension, e.g. .png
+func GenerateFilename(urlStr string, device string, extension string, policy config.URLPolicy) string {
+	u, err := url.Parse(NormalizeURL(urlStr, policy))
 	if err != nil {
-		return generateTimestampFilename()
+		return generateTimestampFilename() + extension
 	}
 
 	filename := strings.ReplaceAll(u.Path, "/", "_")
@@ -120,7 +177,11 @@ func GenerateFilename(urlStr string) string {
 		filename = generateTimestampFilename()
 	}
 
-	return filename + ".png"
+	if device != "" {
+		filename += "__" + strings.Trim(sanitizeFilename(device), "_")
+	}
+
+	return filename + extension
 }
 
 // sanitizefilename sanitizes the filename by replacing invalid chars with underscore, collapsing multiple underscores, trimming, limiting length
@@ -180,6 +241,18 @@ func GetPathFromURL(urlStr string) string {
 	return u.Path
 }
 
+// pathprefix returns the first path segment of the url, e.g. /products for /products/shoes/red,
+// or / for the homepage
+func PathPrefix(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "/"
+	}
+
+	segment, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	return "/" + segment
+}
+
 // hasqueryparams checks if the url has query parameters
 func HasQueryParams(urlStr string) bool {
 	u, err := url.Parse(urlStr)
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+
+	"framely/src/config"
+)
+
+// testnormalizeurl checks that equivalent urls of the same page normalize to one string
+// and that query parameters that identify a page are kept
+func TestNormalizeURL(t *testing.T) {
+	policy := config.DefaultURLPolicy()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://Example.com:443/", "https://example.com/"},
+		{"http://example.com:80/about/", "http://example.com/about"},
+		{"https://example.com:8443/about", "https://example.com:8443/about"},
+		{"https://example.com/docs/index.html", "https://example.com/docs"},
+		{"https://example.com/index.html#top", "https://example.com/"},
+		{"https://example.com/products?page=2", "https://example.com/products?page=2"},
+		{"https://example.com/products?page=2&id=5", "https://example.com/products?id=5&page=2"},
+		{"https://example.com/products?utm_source=mail&fbclid=abc&page=2", "https://example.com/products?page=2"},
+		{"https://example.com/products?utm_source=mail", "https://example.com/products"},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeURL(test.url, policy); got != test.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", test.url, got, test.want)
+		}
+	}
+}
+
+// testnormalizeurlqueryallowlist checks that an allow list keeps only the listed parameters,
+// that the deny list still applies, and that unsorted queries keep their order
+func TestNormalizeURLQueryAllowList(t *testing.T) {
+	policy := config.DefaultURLPolicy()
+	policy.QueryAllow = []string{"page", "filter_*"}
+	policy.SortQuery = false
+
+	got := NormalizeURL("https://example.com/list?sort=asc&page=3&filter_color=red&utm_medium=x", policy)
+	if want := "https://example.com/list?page=3&filter_color=red"; got != want {
+		t.Fatalf("normalized url = %q, want %q", got, want)
+	}
+
+	policy.StripQuery = true
+	got = NormalizeURL("https://example.com/list?page=3", policy)
+	if want := "https://example.com/list"; got != want {
+		t.Fatalf("normalized url with stripped query = %q, want %q", got, want)
+	}
+}
+
+// testgeneratefilenameusespolicy checks that urls that normalize to the same page get the same filename
+// and that a policy stripping queries drops them from the filename
+func TestGenerateFilenameUsesPolicy(t *testing.T) {
+	policy := config.DefaultURLPolicy()
+	want := GenerateFilename("https://example.com/products?page=2", "", ".png", policy)
+	for _, url := range []string{
+		"https://example.com/products/?page=2&utm_campaign=spring",
+		"https://EXAMPLE.com:443/products/index.html?page=2",
+	} {
+		if got := GenerateFilename(url, "", ".png", policy); got != want {
+			t.Errorf("GenerateFilename(%q) = %q, want %q", url, got, want)
+		}
+	}
+
+	policy.StripQuery = true
+	if got := GenerateFilename("https://example.com/products?page=2", "", ".png", policy); got != "products.png" {
+		t.Errorf("GenerateFilename with stripped query = %q, want products.png", got)
+	}
+}